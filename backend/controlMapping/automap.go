@@ -0,0 +1,220 @@
+package controlmapping
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	serialprotocol "modularMidiGoApp/backend/usbUtility/serialProtocol"
+	"time"
+)
+
+// reservedCCs have a fixed meaning (bank select, data entry, (N)RPN, channel mode) and
+// are never handed out by the auto mapping.
+var reservedCCs = map[uint16]bool{0: true, 6: true, 32: true, 38: true, 96: true, 97: true, 98: true, 99: true, 100: true, 101: true}
+
+// firstAutoNote is where buttons start, C1 like most drum pads.
+const firstAutoNote = 36
+
+// errNothingToMap keeps AutoMapModule from rewriting the file when every control is mapped.
+var errNothingToMap = errors.New("nothing to map")
+
+// automapRescan is how often AutoMapper looks for described modules it missed, module
+// events are dropped when it falls behind.
+const automapRescan = 10 * time.Second
+
+// AutoMapper adds mappings for the controls of every module that describes itself.
+// Controls that are mapped already are left alone. Every module is mapped once per
+// attach, so mappings deleted by hand stay deleted until the module joins again.
+func AutoMapper(stopChan <-chan struct{}) {
+	events, cancel := moduleregistry.Subscribe()
+	defer cancel()
+
+	type attachKey struct {
+		source string
+		id     uint8
+	}
+	// FirstSeen of the modules mapped already, a module joining again has a new one
+	mapped := make(map[attachKey]time.Time)
+
+	// Picks up modules described before subscribing or while events were dropped
+	rescan := func() {
+		current := make(map[attachKey]time.Time)
+		for _, m := range moduleregistry.Modules() {
+			key := attachKey{m.Source, m.ID}
+			if m.Descriptor == nil {
+				continue
+			}
+			if seen, ok := mapped[key]; !ok || !seen.Equal(m.FirstSeen) {
+				autoMapDescribed(m)
+			}
+			current[key] = m.FirstSeen
+		}
+		mapped = current
+	}
+	rescan()
+
+	ticker := time.NewTicker(automapRescan)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case <-ticker.C:
+			rescan()
+		case ev := <-events:
+			if ev.Kind == moduleregistry.EventDescribed && ev.Module.Descriptor != nil {
+				autoMapDescribed(ev.Module)
+				mapped[attachKey{ev.Module.Source, ev.Module.ID}] = ev.Module.FirstSeen
+			}
+		}
+	}
+}
+
+func autoMapDescribed(m moduleregistry.Module) {
+	added, err := AutoMapModule(m.ID, m.Descriptor.Controls)
+	if err != nil {
+		log.Printf("Failed to map controls of module %d: %v", m.ID, err)
+	} else if added > 0 {
+		log.Printf("Mapped %d new controls of module %d (%s)", added, m.ID, m.Descriptor.ModuleType)
+	}
+}
+
+// AutoMapModule adds a mapping to the active preset for every control that has none,
+// picking the lowest free number for its kind. It returns how many were added.
+func AutoMapModule(moduleID uint8, controls []serialprotocol.ControlDescriptor) (int, error) {
+	added := 0
+	err := editActivePreset(func(p *Preset) error {
+		for _, c := range controls {
+			if hasMapping(p, moduleID, c.ID) {
+				continue
+			}
+			m, err := autoMapping(p, moduleID, c)
+			if err != nil {
+				log.Printf("Warning: module %d control %d left unmapped: %v", moduleID, c.ID, err)
+				continue
+			}
+			p.Mappings = append(p.Mappings, m)
+			added++
+		}
+		if added == 0 {
+			return errNothingToMap
+		}
+		return nil
+	})
+	if errors.Is(err, errNothingToMap) {
+		return 0, nil
+	}
+	return added, err
+}
+
+func hasMapping(p *Preset, moduleID, controlID uint8) bool {
+	for _, m := range p.Mappings {
+		if m.ModuleID == moduleID && m.ControlID == controlID {
+			return true
+		}
+	}
+	return false
+}
+
+// autoMapping picks the mapping type from the kind of control: buttons play notes,
+// encoders send 7-bit CC and faders and knobs use the default mode.
+func autoMapping(p *Preset, moduleID uint8, c serialprotocol.ControlDescriptor) (Mapping, error) {
+	m := Mapping{
+		ModuleID:  moduleID,
+		ControlID: c.ID,
+		Name:      fmt.Sprintf("%s %d", c.Kind, c.ID),
+		Channel:   defaults.Channel,
+	}
+
+	switch c.Kind {
+	case serialprotocol.KindButton:
+		m.Type = TypeNote
+	case serialprotocol.KindEncoder:
+		m.Type = TypeCC
+	default:
+		m.Type = MappingType(defaults.Mode)
+		if m.Type == "" || c.Resolution <= 7 {
+			m.Type = TypeCC
+		}
+	}
+
+	if m.Type == TypePitchBend {
+		// Pitch bend has no number, every fader needs its own channel
+		for ch := uint16(m.Channel); ch < 16; ch++ {
+			if !used(p, TypePitchBend, uint8(ch), 0) {
+				m.Channel = uint8(ch)
+				return m, nil
+			}
+		}
+		return Mapping{}, fmt.Errorf("no free pitch bend channel")
+	}
+
+	first, last := numberRange(m.Type)
+	for n := first; n <= last; n++ {
+		if !used(p, m.Type, m.Channel, n) {
+			m.Number = n
+			return m, nil
+		}
+	}
+	return Mapping{}, fmt.Errorf("no free %s number on channel %d", m.Type, m.Channel+1)
+}
+
+func numberRange(t MappingType) (uint16, uint16) {
+	switch t {
+	case TypeCC14:
+		return 1, 31
+	case TypeNRPN:
+		return 0, 16383
+	case TypeNote:
+		return firstAutoNote, 127
+	}
+	return 1, 119
+}
+
+// used reports whether number n of type t on channel collides with an existing mapping.
+// CC and 14-bit CC (n and n+32) share the controller numbers of a channel.
+func used(p *Preset, t MappingType, channel uint8, n uint16) bool {
+	ccs := func(t MappingType, n uint16) []uint16 {
+		switch t {
+		case TypeCC:
+			return []uint16{n}
+		case TypeCC14:
+			return []uint16{n, n + 32}
+		}
+		return nil
+	}
+
+	wanted := ccs(t, n)
+	for _, cc := range wanted {
+		if reservedCCs[cc] {
+			return true
+		}
+	}
+
+	for _, m := range p.Mappings {
+		if m.Channel != channel {
+			continue
+		}
+		switch t {
+		case TypePitchBend:
+			if m.Type == t {
+				return true
+			}
+		case TypeNote, TypeNRPN:
+			if m.Type == t && m.Number == n {
+				return true
+			}
+		default:
+			for _, a := range wanted {
+				for _, b := range ccs(m.Type, m.Number) {
+					if a == b {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
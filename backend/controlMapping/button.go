@@ -0,0 +1,277 @@
+package controlmapping
+
+import (
+	"fmt"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	"time"
+)
+
+// Button modes decide what pressing a button does.
+const (
+	ButtonMomentary = "momentary" // On while held
+	ButtonToggle    = "toggle"    // Every press switches between on and off
+	ButtonRadio     = "radio"     // On when pressed, turns the other buttons of its group off
+)
+
+const (
+	defaultLongPress = 500 * time.Millisecond
+	defaultDoubleTap = 300 * time.Millisecond
+	maxButtonTime    = 5000 // Milliseconds
+)
+
+// Button adds behaviours to a control with an on and an off state, e.g. a note or a CC
+// switching between its minimum and maximum. The LED of the button shows the state.
+type Button struct {
+	Mode  string `json:"mode,omitempty"`  // Empty or one of the Button constants, momentary by default
+	Group string `json:"group,omitempty"` // Radio group, only one of its buttons is on
+	// Sent instead of the normal message when the button is held or pressed twice quickly.
+	// With either set, the normal message waits until it is clear that neither happened.
+	LongPress   *ButtonAction `json:"long_press,omitempty"`
+	DoubleTap   *ButtonAction `json:"double_tap,omitempty"`
+	LongPressMs int           `json:"long_press_ms,omitempty"` // 0 for 500
+	DoubleTapMs int           `json:"double_tap_ms,omitempty"` // 0 for 300
+}
+
+// ButtonAction is a message sent by a long press or a double tap. Notes are sent as Note On
+// followed by Note Off, other types with their maximum.
+type ButtonAction struct {
+	Type    MappingType `json:"type"`
+	Channel uint8       `json:"channel"`
+	Number  uint16      `json:"number"`
+	Preset  string      `json:"preset,omitempty"` // Target of preset actions
+}
+
+// buttonState is what the engine remembers per button between readings.
+type buttonState struct {
+	down     bool
+	pending  bool   // Released once, waiting whether a second tap follows
+	consumed bool   // The current press fired its long press or double tap
+	seq      uint64 // Counts presses and releases, timers of earlier ones are ignored
+}
+
+// buttonTimer fires when a button was held long enough or no second tap followed.
+type buttonTimer struct {
+	key  controlKey
+	seq  uint64
+	long bool
+}
+
+// buttonTimers wakes MappingEngine for button timeouts.
+var buttonTimers = make(chan buttonTimer, 16)
+
+// Validate checks the button settings of a mapping.
+func (b Button) Validate(t MappingType) error {
+	if t == TypePreset {
+		return fmt.Errorf("preset mappings have no button behaviours")
+	}
+	switch b.Mode {
+	case "", ButtonMomentary, ButtonToggle:
+		if b.Group != "" {
+			return fmt.Errorf("button group needs mode '%s'", ButtonRadio)
+		}
+	case ButtonRadio:
+		if b.Group == "" {
+			return fmt.Errorf("radio button needs a group")
+		}
+	default:
+		return fmt.Errorf("unknown button mode '%s'", b.Mode)
+	}
+	if b.LongPressMs < 0 || b.LongPressMs > maxButtonTime || b.DoubleTapMs < 0 || b.DoubleTapMs > maxButtonTime {
+		return fmt.Errorf("button times out of range (0-%d ms)", maxButtonTime)
+	}
+	for _, a := range []*ButtonAction{b.LongPress, b.DoubleTap} {
+		if a == nil {
+			continue
+		}
+		if err := a.mapping(Mapping{}).Validate(); err != nil {
+			return fmt.Errorf("button action: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b Button) mode() string {
+	if b.Mode == "" {
+		return ButtonMomentary
+	}
+	return b.Mode
+}
+
+// deferred reports whether the normal message waits for the release of the button.
+func (b Button) deferred() bool {
+	return b.LongPress != nil || b.DoubleTap != nil
+}
+
+func (b Button) longPress() time.Duration {
+	if b.LongPressMs == 0 {
+		return defaultLongPress
+	}
+	return time.Duration(b.LongPressMs) * time.Millisecond
+}
+
+func (b Button) doubleTap() time.Duration {
+	if b.DoubleTapMs == 0 {
+		return defaultDoubleTap
+	}
+	return time.Duration(b.DoubleTapMs) * time.Millisecond
+}
+
+// mapping turns an action into a mapping of the control m belongs to.
+func (a ButtonAction) mapping(m Mapping) Mapping {
+	return Mapping{
+		ModuleID:  m.ModuleID,
+		ControlID: m.ControlID,
+		Type:      a.Type,
+		Channel:   a.Channel,
+		Number:    a.Number,
+		Preset:    a.Preset,
+		Ports:     m.Ports,
+	}
+}
+
+// buttons runs the button state machines of MappingEngine.
+type buttons struct {
+	table  *mappingTable
+	states map[controlKey]*controlState
+	out    chan<- midiOutputPipeline.MidiMessage
+}
+
+// reading handles a reading of a button with behaviours.
+func (bs buttons) reading(key controlKey, m Mapping, value float64) {
+	if m.Invert {
+		value = 1 - value
+	}
+	b := *m.Button
+	state := stateFor(bs.states, key)
+	down := value >= 0.5
+	if down == state.button.down {
+		return
+	}
+	state.button.down = down
+	state.button.seq++
+
+	if down {
+		if state.button.pending {
+			state.button.pending = false
+			state.button.consumed = true
+			bs.action(m, *b.DoubleTap)
+			return
+		}
+		state.button.consumed = false
+		if b.LongPress != nil {
+			startButtonTimer(b.longPress(), buttonTimer{key, state.button.seq, true})
+		}
+		if !b.deferred() {
+			bs.press(key, m)
+		}
+		return
+	}
+
+	switch {
+	case state.button.consumed:
+	case !b.deferred():
+		if b.mode() == ButtonMomentary {
+			bs.set(key, m, false)
+		}
+	case b.DoubleTap != nil:
+		state.button.pending = true
+		startButtonTimer(b.doubleTap(), buttonTimer{key, state.button.seq, false})
+	default:
+		bs.tap(key, m)
+	}
+}
+
+// timeout handles a timer of a button once it fired.
+func (bs buttons) timeout(t buttonTimer) {
+	m, ok := bs.table.index[t.key]
+	state, found := bs.states[t.key]
+	if !ok || !found || m.Button == nil || state.button.seq != t.seq {
+		return
+	}
+
+	if t.long {
+		if state.button.down && !state.button.consumed {
+			state.button.consumed = true
+			bs.action(m, *m.Button.LongPress)
+		}
+		return
+	}
+	if state.button.pending {
+		state.button.pending = false
+		bs.tap(t.key, m)
+	}
+}
+
+// tap is a press and release that turned out to be neither long press nor double tap.
+func (bs buttons) tap(key controlKey, m Mapping) {
+	bs.press(key, m)
+	if m.Button.mode() == ButtonMomentary {
+		bs.set(key, m, false)
+	}
+}
+
+// press switches a button on, or over for toggles.
+func (bs buttons) press(key controlKey, m Mapping) {
+	state := stateFor(bs.states, key)
+	switch m.Button.mode() {
+	case ButtonToggle:
+		// The DAW may have switched the parameter since
+		if daw, ok := takeDAWValue(key); ok {
+			state.pressed = daw >= 0.5
+		}
+		bs.set(key, m, !state.pressed)
+	case ButtonRadio:
+		for _, other := range bs.table.file.Presets[bs.table.active].Mappings {
+			otherKey := controlKey{other.ModuleID, other.ControlID}
+			if otherKey == key || other.Button == nil || other.Button.mode() != ButtonRadio || other.Button.Group != m.Button.Group {
+				continue
+			}
+			if stateFor(bs.states, otherKey).pressed {
+				bs.set(otherKey, other, false)
+			}
+		}
+		bs.set(key, m, true)
+	default:
+		bs.set(key, m, true)
+	}
+}
+
+// set sends the message of a button for on or off and updates its LED.
+func (bs buttons) set(key controlKey, m Mapping, on bool) {
+	state := stateFor(bs.states, key)
+	m.Invert = false // Already applied to the reading
+	value := 0.0
+	if on {
+		value = 1
+	}
+	bs.send(m, apply(m, value, state))
+	state.pressed = on
+	sendToControl(m, value)
+}
+
+// action sends the message of a long press or double tap.
+func (bs buttons) action(m Mapping, a ButtonAction) {
+	am := a.mapping(m)
+	if am.Type == TypePreset {
+		requestPreset(m.ModuleID, m.ControlID, am.Preset)
+		return
+	}
+
+	var state controlState
+	msgs := apply(am, 1, &state)
+	if am.Type == TypeNote {
+		msgs = append(msgs, apply(am, 0, &state)...)
+	}
+	bs.send(am, msgs)
+}
+
+// send passes every message on, a quick press and release must not be merged.
+func (bs buttons) send(m Mapping, msgs []midiOutputPipeline.MidiMessage) {
+	for _, msg := range msgs {
+		emit(bs.out, m, midiOutputPipeline.DiscreteMessage{Message: msg})
+	}
+}
+
+func startButtonTimer(d time.Duration, t buttonTimer) {
+	time.AfterFunc(d, func() { buttonTimers <- t })
+}
@@ -0,0 +1,86 @@
+package controlmapping
+
+import (
+	"fmt"
+	"math"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+)
+
+// Curves shape the travel of a control before it is scaled to the output range.
+const (
+	CurveLinear = "linear"
+	CurveLog    = "log"    // Rises fast, then flattens
+	CurveExp    = "exp"    // Starts flat, then rises fast, like audio taper volume faders
+	CurveS      = "scurve" // Fine control at both ends, fast in the middle
+	CurveTable  = "table"  // Interpolated between the points of CurveTable
+)
+
+// curveSteepness is how far log and exp bend away from linear.
+const curveSteepness = 4
+
+// maxCurveTable keeps lookup tables to a size that can still be edited by hand.
+const maxCurveTable = 128
+
+// validateCurve checks the curve of a mapping and its lookup table.
+func (m Mapping) validateCurve() error {
+	switch m.Curve {
+	case "", CurveLinear, CurveLog, CurveExp, CurveS:
+		if len(m.CurveTable) > 0 {
+			return fmt.Errorf("curve table needs curve '%s'", CurveTable)
+		}
+	case CurveTable:
+		if len(m.CurveTable) < 2 || len(m.CurveTable) > maxCurveTable {
+			return fmt.Errorf("curve table needs 2-%d points, got %d", maxCurveTable, len(m.CurveTable))
+		}
+		for _, v := range m.CurveTable {
+			if v < 0 || v > 1 {
+				return fmt.Errorf("curve table point %g out of range (0-1)", v)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown curve '%s'", m.Curve)
+	}
+	return nil
+}
+
+// shape applies the curve of a mapping to a normalized value.
+func (m Mapping) shape(x float64) float64 {
+	x = midiOutputPipeline.Clamp01(x)
+	switch m.Curve {
+	case CurveLog:
+		return math.Log1p(x*math.Expm1(curveSteepness)) / curveSteepness
+	case CurveExp:
+		return math.Expm1(x*curveSteepness) / math.Expm1(curveSteepness)
+	case CurveS:
+		return x * x * (3 - 2*x)
+	case CurveTable:
+		// The points are spread evenly over the travel of the control
+		pos := x * float64(len(m.CurveTable)-1)
+		i := int(pos)
+		if i >= len(m.CurveTable)-1 {
+			return m.CurveTable[len(m.CurveTable)-1]
+		}
+		frac := pos - float64(i)
+		return m.CurveTable[i] + frac*(m.CurveTable[i+1]-m.CurveTable[i])
+	}
+	return x
+}
+
+// unshape finds the control value shape turns into y, for feedback from the DAW.
+// Tables that go down somewhere give one of the matching values.
+func (m Mapping) unshape(y float64) float64 {
+	if m.Curve == "" || m.Curve == CurveLinear {
+		return y
+	}
+	falling := m.shape(1) < m.shape(0)
+	lo, hi := 0.0, 1.0
+	for range 32 {
+		mid := (lo + hi) / 2
+		if (m.shape(mid) < y) != falling {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
@@ -0,0 +1,108 @@
+package controlmapping
+
+import (
+	"fmt"
+	"math"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	"time"
+)
+
+// Encoder modes decide what the movements of rotary encoders send.
+const (
+	// EncoderAbsolute adds the movements up and sends the position like a knob would
+	EncoderAbsolute = "absolute"
+	// Relative encodings send every movement as CC value, shown for one step up and down
+	EncoderTwosComplement = "twos_complement" // 1 and 127
+	EncoderSignedBit      = "signed_bit"      // 1 and 65
+	EncoderBinaryOffset   = "binary_offset"   // 65 and 63
+)
+
+// defaultEncoderSteps makes one detent one step of a 7-bit CC.
+const defaultEncoderSteps = 127
+
+// maxAcceleration is the largest extra factor a fast turn can get.
+const maxAcceleration = 16
+
+// accelerationSpeed is the speed in detents per second at which the full acceleration applies.
+const accelerationSpeed = 40
+
+// maxRelativeStep is the largest movement the relative encodings can carry in one message.
+const maxRelativeStep = 63
+
+// encoderState is what the engine remembers per encoder between movements.
+type encoderState struct {
+	position float64 // Normalized position in absolute mode
+	lastTurn time.Time
+}
+
+// validateEncoder checks the encoder settings of a mapping.
+func (m Mapping) validateEncoder() error {
+	switch m.Encoder {
+	case "", EncoderAbsolute:
+	case EncoderTwosComplement, EncoderSignedBit, EncoderBinaryOffset:
+		if m.Type != TypeCC {
+			return fmt.Errorf("relative encoder mode '%s' needs type '%s'", m.Encoder, TypeCC)
+		}
+	default:
+		return fmt.Errorf("unknown encoder mode '%s'", m.Encoder)
+	}
+	if m.EncoderSteps < 0 || m.EncoderSteps > 16383 {
+		return fmt.Errorf("encoder steps %d out of range (0-16383)", m.EncoderSteps)
+	}
+	if m.Acceleration < 0 || m.Acceleration > maxAcceleration {
+		return fmt.Errorf("acceleration %g out of range (0-%d)", m.Acceleration, maxAcceleration)
+	}
+	return nil
+}
+
+// relativeEncoder reports whether the mapping sends movements instead of positions.
+func (m Mapping) relativeEncoder() bool {
+	return m.Encoder != "" && m.Encoder != EncoderAbsolute
+}
+
+// turn returns the movement after acceleration, which grows with the speed of the turn.
+func (s *encoderState) turn(m Mapping, delta int, now time.Time) float64 {
+	steps := float64(delta)
+	if m.Acceleration > 0 && !s.lastTurn.IsZero() {
+		if dt := now.Sub(s.lastTurn).Seconds(); dt > 0 {
+			speed := math.Min(math.Abs(steps)/dt/accelerationSpeed, 1)
+			steps *= 1 + m.Acceleration*speed
+		}
+	}
+	s.lastTurn = now
+	return steps
+}
+
+// move adds a movement to the position of an absolute encoder and returns the new position.
+func (s *encoderState) move(m Mapping, steps float64) float64 {
+	full := m.EncoderSteps
+	if full == 0 {
+		full = defaultEncoderSteps
+	}
+	s.position = midiOutputPipeline.Clamp01(s.position + steps/float64(full))
+	return s.position
+}
+
+// relativeMessage encodes a movement as CC in the encoding of the mapping.
+func relativeMessage(m Mapping, steps float64) midiOutputPipeline.MidiMessage {
+	n := int(math.Round(steps))
+	if m.Invert {
+		n = -n
+	}
+	n = max(-maxRelativeStep, min(maxRelativeStep, n))
+
+	var value uint8
+	switch m.Encoder {
+	case EncoderTwosComplement:
+		value = uint8(n) & 0x7F
+	case EncoderSignedBit:
+		if n < 0 {
+			value = 0x40 | uint8(-n)
+		} else {
+			value = uint8(n)
+		}
+	case EncoderBinaryOffset:
+		value = uint8(64 + n)
+	}
+	return midiOutputPipeline.MidiRelativeCCMessage{Channel: m.Channel, Controller: uint8(m.Number), Value: value}
+}
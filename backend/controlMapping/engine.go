@@ -0,0 +1,289 @@
+package controlmapping
+
+import (
+	"log"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	serialprotocol "modularMidiGoApp/backend/usbUtility/serialProtocol"
+	"sync"
+	"time"
+)
+
+// ControlEvent is a control reading from any transport.
+type ControlEvent struct {
+	ModuleID  uint8
+	ControlID uint8
+	Value     float64 // Normalized to 0-1 using the input range of the transport
+	Delta     int     // Detents an encoder turned, positive clockwise. Set instead of Value
+	Raw       int     // Value or delta as sent by the module
+	Source    string  // Transport the event came from, e.g. "usb" or "udp"
+}
+
+// EventChannel is fed by the input transports and drained by MappingEngine.
+var EventChannel = make(chan ControlEvent, 256)
+
+// controlState is what the engine remembers per control between events.
+type controlState struct {
+	pressed bool                       // For note and program change mappings, and the state of buttons
+	kind    serialprotocol.ControlKind // From the descriptor, 0 until the module described itself
+	filter  filterState
+	encoder encoderState
+	button  buttonState
+}
+
+// MappingEngine turns the events of EventChannel into MIDI messages on outputChan.
+func MappingEngine(outputChan chan<- midiOutputPipeline.MidiMessage) {
+	states := make(map[controlKey]*controlState)
+	table := current.Load()
+
+	// Every event uses the latest table, even if tableChanged wasn't read yet
+	follow := func() {
+		if next := current.Load(); next != table {
+			// Notes held in the previous preset would hang forever otherwise
+			releaseNotes(table, states, outputChan)
+			table = next
+		}
+	}
+
+	for {
+		var ev ControlEvent
+		select {
+		case <-tableChanged:
+			follow()
+			continue
+		case t := <-buttonTimers:
+			follow()
+			buttons{table, states, outputChan}.timeout(t)
+			continue
+		case ev = <-EventChannel:
+			follow()
+		}
+
+		key := controlKey{ev.ModuleID, ev.ControlID}
+		m, ok := table.index[key]
+		if !ok {
+			m = defaultMapping(ev.ModuleID, ev.ControlID)
+		}
+
+		state := stateFor(states, key)
+
+		value := ev.Value
+		if ev.Delta != 0 {
+			steps := state.encoder.turn(m, ev.Delta, time.Now())
+			if m.relativeEncoder() {
+				valueEvents.Publish(ev)
+				emit(outputChan, m, relativeMessage(m, steps))
+				continue
+			}
+			// Follow the DAW, so turning continues from where the parameter is
+			if daw, ok := takeDAWValue(key); ok {
+				state.encoder.position = daw
+			}
+			value = state.encoder.move(m, steps)
+		} else if m.Filter != nil {
+			state.filter.configure(*m.Filter)
+			if target, ok := takeDAWValue(key); ok && m.Filter.Pickup {
+				state.filter.pickUp(target)
+			}
+			if value, ok = state.filter.step(value); !ok {
+				continue
+			}
+		}
+
+		filtered := ev
+		filtered.Value, filtered.Delta = value, 0
+		valueEvents.Publish(filtered)
+
+		if m.Type == TypePreset {
+			switchPreset(m, value, state)
+			continue
+		}
+		if m.Button != nil {
+			buttons{table, states, outputChan}.reading(key, m, value)
+			continue
+		}
+
+		momentary := state.momentary(key)
+		for _, msg := range apply(m, value, state) {
+			if momentary {
+				msg = midiOutputPipeline.DiscreteMessage{Message: msg}
+			}
+			emit(outputChan, m, msg)
+		}
+	}
+}
+
+// momentary reports whether a control is a button, whose presses and releases all have
+// to reach the DAW instead of only its latest state.
+func (s *controlState) momentary(key controlKey) bool {
+	if s.kind == 0 {
+		if m, ok := moduleregistry.Lookup(key.module); ok && m.Descriptor != nil {
+			for _, c := range m.Descriptor.Controls {
+				if c.ID == key.control {
+					s.kind = c.Kind
+				}
+			}
+		}
+	}
+	return s.kind == serialprotocol.KindButton
+}
+
+func stateFor(states map[controlKey]*controlState, key controlKey) *controlState {
+	state, ok := states[key]
+	if !ok {
+		state = &controlState{}
+		states[key] = state
+	}
+	return state
+}
+
+// switchPreset activates the target of a preset mapping when its button is pressed.
+func switchPreset(m Mapping, value float64, state *controlState) {
+	pressed := value >= 0.5
+	if pressed == state.pressed {
+		return
+	}
+	state.pressed = pressed
+	if !pressed {
+		return
+	}
+
+	requestPreset(m.ModuleID, m.ControlID, m.Preset)
+}
+
+// presetRequest asks presetSwitcher to activate a preset for a control.
+type presetRequest struct {
+	moduleID, controlID uint8
+	name                string // Empty for the next preset
+}
+
+var (
+	presetRequests = make(chan presetRequest, 8)
+	switcherOnce   sync.Once
+)
+
+// requestPreset switches presets for MappingEngine without waiting for the mapping file
+// to be written. The new table is used as soon as it is published.
+func requestPreset(moduleID, controlID uint8, name string) {
+	switcherOnce.Do(func() { go presetSwitcher() })
+	select {
+	case presetRequests <- presetRequest{moduleID, controlID, name}:
+	default:
+		log.Printf("Warning: too many preset switches queued, dropping the one of module %d control %d", moduleID, controlID)
+	}
+}
+
+func presetSwitcher() {
+	for r := range presetRequests {
+		// Resolved here so quick presses of a next button each move on by one
+		name := r.name
+		if name == "" {
+			name = nextPresetName()
+		}
+		if err := ActivatePreset(name); err != nil {
+			log.Printf("Warning: module %d control %d: %v", r.moduleID, r.controlID, err)
+		}
+	}
+}
+
+// releaseNotes sends Note Off for every note still held by a mapping of table and
+// switches off the LEDs of latched note buttons, which are off now as well.
+func releaseNotes(table *mappingTable, states map[controlKey]*controlState, outputChan chan<- midiOutputPipeline.MidiMessage) {
+	for key, state := range states {
+		m, ok := table.index[key]
+		if !ok || m.Type != TypeNote || !state.pressed {
+			continue
+		}
+		state.pressed = false
+		emit(outputChan, m, midiOutputPipeline.MidiNoteOffMessage{Channel: m.Channel, Key: uint8(m.Number)})
+		if m.Button != nil {
+			sendToControl(m, 0)
+		}
+	}
+}
+
+// emit sends a message of mapping m, marked with its control for the subscribers of
+// the sent messages.
+func emit(outputChan chan<- midiOutputPipeline.MidiMessage, m Mapping, msg midiOutputPipeline.MidiMessage) {
+	source := midiOutputPipeline.MessageSource{ModuleID: m.ModuleID, ControlID: m.ControlID}
+	outputChan <- route(m, midiOutputPipeline.SourcedMessage{Source: source, Message: msg})
+}
+
+// route limits msg to the output ports of a mapping.
+func route(m Mapping, msg midiOutputPipeline.MidiMessage) midiOutputPipeline.MidiMessage {
+	if len(m.Ports) == 0 {
+		return msg
+	}
+	return midiOutputPipeline.RoutedMessage{Ports: m.Ports, Message: msg}
+}
+
+// defaultMapping is used for controls without an entry in the mapping file.
+func defaultMapping(moduleID, controlID uint8) Mapping {
+	mode, ok := defaults.Modes[controlID]
+	if !ok {
+		mode = defaults.Mode
+	}
+	if mode == "" {
+		mode = midiOutputPipeline.ModeCC
+	}
+	return Mapping{
+		ModuleID:  moduleID,
+		ControlID: controlID,
+		Type:      MappingType(mode),
+		Channel:   defaults.Channel,
+		Number:    uint16(controlID),
+	}
+}
+
+// apply converts a normalized control value into the messages of a mapping.
+func apply(m Mapping, value float64, state *controlState) []midiOutputPipeline.MidiMessage {
+	if m.Invert {
+		value = 1 - value
+	}
+	lo, hi := m.outputRange()
+	out := lo + m.shape(value)*(hi-lo)
+
+	switch m.Type {
+	case TypeCC, TypeCC14, TypeNRPN, TypePitchBend:
+		msg, err := midiOutputPipeline.BuildControlMessage(midiOutputPipeline.OutputMode(m.Type), m.Channel, m.Number, out)
+		if err != nil {
+			log.Printf("Warning: module %d control %d: %v", m.ModuleID, m.ControlID, err)
+			return nil
+		}
+		return []midiOutputPipeline.MidiMessage{msg}
+
+	case TypeAfterTouch:
+		return []midiOutputPipeline.MidiMessage{
+			midiOutputPipeline.MidiAfterTouchMessage{Channel: m.Channel, Pressure: midiOutputPipeline.Scale7(out)},
+		}
+
+	case TypeNote:
+		pressed := value >= 0.5
+		if pressed == state.pressed {
+			return nil
+		}
+		state.pressed = pressed
+		if pressed {
+			return []midiOutputPipeline.MidiMessage{
+				midiOutputPipeline.MidiNoteOnMessage{Channel: m.Channel, Key: uint8(m.Number), Velocity: midiOutputPipeline.Scale7(hi)},
+			}
+		}
+		return []midiOutputPipeline.MidiMessage{
+			midiOutputPipeline.MidiNoteOffMessage{Channel: m.Channel, Key: uint8(m.Number)},
+		}
+
+	case TypeProgramChange:
+		pressed := value >= 0.5
+		if pressed == state.pressed {
+			return nil
+		}
+		state.pressed = pressed
+		if !pressed {
+			return nil
+		}
+		return []midiOutputPipeline.MidiMessage{
+			midiOutputPipeline.MidiProgramChangeMessage{Channel: m.Channel, Program: uint8(m.Number)},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package controlmapping
+
+import (
+	"log"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	serialprotocol "modularMidiGoApp/backend/usbUtility/serialProtocol"
+)
+
+// feedbackScale is the full scale of the values in MsgFeedback frames.
+const feedbackScale = 16383
+
+// feedbackState assembles 14-bit CC and NRPN values the DAW sends in several messages.
+type feedbackState struct {
+	msb       map[[2]uint8]uint8 // (channel, controller) -> last MSB of a 14-bit CC
+	parameter [16]uint16         // Selected NRPN parameter per channel
+	dataMSB   [16]uint8          // Last NRPN data entry MSB per channel
+	program   map[uint8]uint8    // Last program per channel
+}
+
+// FeedbackEngine maps the messages received from the DAW back to the controls that send
+// them and forwards the values to the modules, e.g. for LED rings or motorised faders.
+func FeedbackEngine(inChan <-chan midiOutputPipeline.MidiMessage) {
+	state := &feedbackState{
+		msb:     make(map[[2]uint8]uint8),
+		program: make(map[uint8]uint8),
+	}
+
+	for msg := range inChan {
+		t := current.Load()
+		for _, m := range t.file.Presets[t.active].Mappings {
+			value, ok := state.match(m, msg)
+			if !ok {
+				continue
+			}
+			sendFeedback(m, value)
+		}
+		state.update(msg)
+	}
+}
+
+// match returns the normalized value msg sets for mapping m, before the mapping's range,
+// curve and invert are undone.
+func (s *feedbackState) match(m Mapping, msg midiOutputPipeline.MidiMessage) (float64, bool) {
+	switch msg := msg.(type) {
+	case midiOutputPipeline.MidiCCMessage:
+		if msg.Channel != m.Channel {
+			return 0, false
+		}
+		cc := uint16(msg.Controller)
+		switch m.Type {
+		case TypeCC:
+			if cc == m.Number {
+				return float64(msg.Value) / 127, true
+			}
+		case TypeCC14:
+			// The MSB alone already moves the control, the LSB refines it
+			if cc == m.Number {
+				return float64(uint16(msg.Value)<<7) / feedbackScale, true
+			}
+			if cc == m.Number+32 {
+				msb := s.msb[[2]uint8{msg.Channel, uint8(m.Number)}]
+				return float64(uint16(msb)<<7|uint16(msg.Value)) / feedbackScale, true
+			}
+		case TypeNRPN:
+			if s.parameter[msg.Channel] != m.Number {
+				return 0, false
+			}
+			switch msg.Controller {
+			case 6:
+				return float64(uint16(msg.Value)<<7) / feedbackScale, true
+			case 38:
+				return float64(uint16(s.dataMSB[msg.Channel])<<7|uint16(msg.Value)) / feedbackScale, true
+			}
+		}
+	case midiOutputPipeline.MidiNoteOnMessage:
+		if m.Type == TypeNote && msg.Channel == m.Channel && uint16(msg.Key) == m.Number {
+			return float64(msg.Velocity) / 127, true
+		}
+	case midiOutputPipeline.MidiNoteOffMessage:
+		if m.Type == TypeNote && msg.Channel == m.Channel && uint16(msg.Key) == m.Number {
+			return 0, true
+		}
+	case midiOutputPipeline.MidiPitchBendMessage:
+		if m.Type == TypePitchBend && msg.Channel == m.Channel {
+			return float64(int(msg.Value)+8192) / feedbackScale, true
+		}
+	case midiOutputPipeline.MidiProgramChangeMessage:
+		// Lights the button of the current program and turns off the previous one
+		if m.Type == TypeProgramChange && msg.Channel == m.Channel {
+			if uint16(msg.Program) == m.Number {
+				return 1, true
+			}
+			if previous, ok := s.program[msg.Channel]; ok && uint16(previous) == m.Number {
+				return 0, true
+			}
+		}
+	case midiOutputPipeline.MidiAfterTouchMessage:
+		if m.Type == TypeAfterTouch && msg.Channel == m.Channel {
+			return float64(msg.Pressure) / 127, true
+		}
+	}
+	return 0, false
+}
+
+// update remembers the parts of multi-message values once all mappings were matched.
+func (s *feedbackState) update(msg midiOutputPipeline.MidiMessage) {
+	switch msg := msg.(type) {
+	case midiOutputPipeline.MidiCCMessage:
+		ch := msg.Channel & 0x0F
+		switch msg.Controller {
+		case 99:
+			s.parameter[ch] = uint16(msg.Value)<<7 | s.parameter[ch]&0x7F
+		case 98:
+			s.parameter[ch] = s.parameter[ch]&^0x7F | uint16(msg.Value)
+		case 6:
+			s.dataMSB[ch] = msg.Value
+		}
+		if msg.Controller < 32 {
+			s.msb[[2]uint8{msg.Channel, msg.Controller}] = msg.Value
+		}
+	case midiOutputPipeline.MidiProgramChangeMessage:
+		s.program[msg.Channel] = msg.Program
+	}
+}
+
+// sendFeedback undoes the range, curve and invert of a mapping and sends the value to its module.
+// Mappings of modules that aren't attached are skipped.
+func sendFeedback(m Mapping, value float64) {
+	lo, hi := m.outputRange()
+	if hi != lo {
+		value = (value - lo) / (hi - lo)
+	}
+	value = m.unshape(midiOutputPipeline.Clamp01(value))
+	if m.Invert {
+		value = 1 - value
+	}
+
+	// Soft takeover and encoders also follow the DAW for modules that are attached later
+	setDAWValue(controlKey{m.ModuleID, m.ControlID}, value)
+	sendToControl(m, value)
+}
+
+// sendToControl sends a normalized value to the control of a mapping, e.g. to light the
+// LED of a button.
+func sendToControl(m Mapping, value float64) {
+	if _, ok := moduleregistry.Lookup(m.ModuleID); !ok {
+		return
+	}
+	if err := SendToControl(m.ModuleID, m.ControlID, value); err != nil {
+		log.Printf("Failed to send feedback to module %d control %d: %v", m.ModuleID, m.ControlID, err)
+	}
+}
+
+// SendToControl sends a normalized value (0-1) to a control as MsgFeedback, e.g. to set
+// an LED or move a motorised fader.
+func SendToControl(moduleID, controlID uint8, value float64) error {
+	payload := serialprotocol.ControlValuePayload(serialprotocol.ControlValue{
+		Control: controlID,
+		Value:   uint16(midiOutputPipeline.Clamp01(value)*feedbackScale + 0.5),
+	})
+	return moduleregistry.SendToModule(moduleID, serialprotocol.MsgFeedback, payload)
+}
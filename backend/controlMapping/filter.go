@@ -0,0 +1,169 @@
+package controlmapping
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Filter tames noisy analog controls before their values are mapped. The stages run in
+// the order of the fields, each one is off at its zero value.
+type Filter struct {
+	// Median of the last Median readings, which removes single spikes (0 or 1 is off, at most 15)
+	Median int `json:"median,omitempty"`
+	// Exponential moving average: weight of the previous value from 0 (off) to below 1
+	Smoothing float64 `json:"smoothing,omitempty"`
+	// Changes smaller than this fraction of the full travel are ignored (0-0.5)
+	Deadband float64 `json:"deadband,omitempty"`
+	// Soft takeover: after the DAW moved the parameter, the control is ignored until it
+	// reaches the DAW's value, so the parameter doesn't jump. Needs feedback from the DAW.
+	Pickup bool `json:"pickup,omitempty"`
+}
+
+// maxMedian keeps the window small, a longer one only adds latency.
+const maxMedian = 15
+
+// pickupWindow is how close a control has to get to the DAW's value to take over.
+const pickupWindow = 0.02
+
+// Validate checks the filter settings of a mapping.
+func (f Filter) Validate() error {
+	if f.Median < 0 || f.Median > maxMedian {
+		return fmt.Errorf("median window %d out of range (0-%d)", f.Median, maxMedian)
+	}
+	if f.Smoothing < 0 || f.Smoothing >= 1 {
+		return fmt.Errorf("smoothing %g out of range (0 to below 1)", f.Smoothing)
+	}
+	if f.Deadband < 0 || f.Deadband > 0.5 {
+		return fmt.Errorf("deadband %g out of range (0-0.5)", f.Deadband)
+	}
+	return nil
+}
+
+// DAWValue is a value the DAW sent for the parameter of a control in a recorded stream,
+// arriving before the reading with index Before.
+type DAWValue struct {
+	Before int
+	Value  float64
+}
+
+// Apply runs a recorded stream of normalized readings through the filter and returns
+// the values that would be mapped, e.g. to tune the settings for a module. daw lists the
+// values of the DAW in between for soft takeover.
+func (f Filter) Apply(values []float64, daw ...DAWValue) []float64 {
+	var s filterState
+	s.configure(f)
+	out := make([]float64, 0, len(values))
+	for i, v := range values {
+		for _, d := range daw {
+			if d.Before == i && f.Pickup {
+				s.pickUp(d.Value)
+			}
+		}
+		if v, ok := s.step(v); ok {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// filterState is what a filter remembers per control between readings.
+type filterState struct {
+	conf    Filter    // Settings the state was built for, a change starts over
+	window  []float64 // Last readings for the median, oldest first
+	average float64
+	last    float64 // Last value passed on
+	started bool    // average and last are valid
+
+	target  float64 // Value of the DAW to pick up
+	waiting bool    // The control hasn't reached target yet
+	reading float64 // Previous reading while waiting, to notice the control crossing target
+}
+
+// configure starts over when the settings of the mapping changed.
+func (s *filterState) configure(f Filter) {
+	if f != s.conf {
+		*s = filterState{conf: f}
+	}
+}
+
+// step filters one reading and reports whether it should be mapped.
+func (s *filterState) step(value float64) (float64, bool) {
+	f := s.conf
+	if f.Median > 1 {
+		s.window = append(s.window, value)
+		if len(s.window) > f.Median {
+			s.window = s.window[1:]
+		}
+		value = median(s.window)
+	}
+
+	if f.Smoothing > 0 && s.started && value > 0 && value < 1 {
+		// The ends are passed through, otherwise the average never quite reaches them
+		value = f.Smoothing*s.average + (1-f.Smoothing)*value
+	}
+	s.average = value
+
+	if s.started && math.Abs(value-s.last) < f.Deadband && value != 0 && value != 1 {
+		return 0, false
+	}
+
+	if s.waiting {
+		crossed := (s.reading-s.target)*(value-s.target) <= 0
+		s.reading = value
+		if !crossed && math.Abs(value-s.target) > pickupWindow {
+			return 0, false
+		}
+		s.waiting = false
+	}
+
+	s.last = value
+	s.started = true
+	return value, true
+}
+
+// pickUp makes the control wait until it reaches target.
+func (s *filterState) pickUp(target float64) {
+	if s.started && math.Abs(s.last-target) <= pickupWindow {
+		return
+	}
+	s.target = target
+	s.waiting = true
+	s.reading = s.last
+	if !s.started {
+		// The position of the control is unknown, it has to come close to target
+		s.reading = math.NaN()
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// dawValues holds the last values the DAW sent for mapped controls, written by
+// FeedbackEngine and taken by MappingEngine for soft takeover and absolute encoders.
+var dawValues = struct {
+	sync.Mutex
+	values map[controlKey]float64
+}{values: make(map[controlKey]float64)}
+
+func setDAWValue(key controlKey, value float64) {
+	dawValues.Lock()
+	defer dawValues.Unlock()
+	dawValues.values[key] = value
+}
+
+func takeDAWValue(key controlKey) (float64, bool) {
+	dawValues.Lock()
+	defer dawValues.Unlock()
+	value, ok := dawValues.values[key]
+	delete(dawValues.values, key)
+	return value, ok
+}
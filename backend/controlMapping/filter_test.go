@@ -0,0 +1,126 @@
+package controlmapping
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFilterApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		in     []float64
+		daw    []DAWValue
+		want   []float64
+	}{
+		{
+			name:   "off passes everything",
+			filter: Filter{},
+			in:     []float64{0.1, 0.1, 0.9, 0.2},
+			want:   []float64{0.1, 0.1, 0.9, 0.2},
+		},
+		{
+			name:   "median removes a spike",
+			filter: Filter{Median: 3},
+			in:     []float64{0.5, 0.5, 0.9, 0.5, 0.5},
+			want:   []float64{0.5, 0.5, 0.5, 0.5, 0.5},
+		},
+		{
+			name:   "median follows a real move",
+			filter: Filter{Median: 3},
+			in:     []float64{0.2, 0.2, 0.8, 0.8, 0.8},
+			want:   []float64{0.2, 0.2, 0.2, 0.8, 0.8},
+		},
+		{
+			name:   "smoothing averages the middle",
+			filter: Filter{Smoothing: 0.5},
+			in:     []float64{0.2, 0.6, 0.6},
+			want:   []float64{0.2, 0.4, 0.5},
+		},
+		{
+			name:   "smoothing passes the ends through",
+			filter: Filter{Smoothing: 0.9},
+			in:     []float64{0.5, 1, 0.5, 0},
+			want:   []float64{0.5, 1, 0.95, 0},
+		},
+		{
+			name:   "deadband suppresses small changes",
+			filter: Filter{Deadband: 0.05},
+			in:     []float64{0.5, 0.52, 0.54, 0.56, 0.55},
+			want:   []float64{0.5, 0.56},
+		},
+		{
+			name:   "deadband lets the ends through",
+			filter: Filter{Deadband: 0.05},
+			in:     []float64{0.98, 1, 0.02, 0},
+			want:   []float64{0.98, 1, 0.02, 0},
+		},
+		{
+			name:   "pickup waits until the control crosses the DAW value",
+			filter: Filter{Pickup: true},
+			in:     []float64{0.2, 0.3, 0.5, 0.7, 0.8},
+			daw:    []DAWValue{{Before: 2, Value: 0.6}},
+			want:   []float64{0.2, 0.3, 0.7, 0.8},
+		},
+		{
+			name:   "pickup crossing from above",
+			filter: Filter{Pickup: true},
+			in:     []float64{0.9, 0.8, 0.1},
+			daw:    []DAWValue{{Before: 1, Value: 0.3}},
+			want:   []float64{0.9, 0.1},
+		},
+		{
+			name:   "pickup from an unknown position waits for the control",
+			filter: Filter{Pickup: true},
+			in:     []float64{0.1, 0.2, 0.49, 0.6},
+			daw:    []DAWValue{{Before: 0, Value: 0.5}},
+			want:   []float64{0.49, 0.6},
+		},
+		{
+			name:   "pickup not needed when the control is at the DAW value",
+			filter: Filter{Pickup: true},
+			in:     []float64{0.5, 0.6},
+			daw:    []DAWValue{{Before: 1, Value: 0.51}},
+			want:   []float64{0.5, 0.6},
+		},
+		{
+			name:   "DAW values are ignored without pickup",
+			filter: Filter{},
+			in:     []float64{0.2, 0.3, 0.5},
+			daw:    []DAWValue{{Before: 1, Value: 0.9}},
+			want:   []float64{0.2, 0.3, 0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			got := tt.filter.Apply(tt.in, tt.daw...)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Apply(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+					t.Fatalf("Apply(%v) = %v, want %v", tt.in, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	invalid := []Filter{
+		{Median: -1},
+		{Median: maxMedian + 1},
+		{Smoothing: 1},
+		{Smoothing: -0.1},
+		{Deadband: 0.6},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted invalid settings", f)
+		}
+	}
+}
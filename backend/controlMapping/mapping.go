@@ -0,0 +1,407 @@
+// Package controlmapping sits between the input transports and the MIDI output pipeline.
+// It maps (module ID, control ID) to the MIDI message a control should produce.
+package controlmapping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	getvalues "modularMidiGoApp/backend/getValues"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// MappingFileVersion is the version written by this driver. Older files are migrated on load.
+//
+//	1: a single list of mappings
+//	2: named presets, one of them active
+const MappingFileVersion = 2
+
+// DefaultPresetName is used for mappings migrated from version 1 and for new files.
+const DefaultPresetName = "default"
+
+// MappingType is the kind of MIDI message a control produces.
+type MappingType string
+
+const (
+	TypeCC            MappingType = "cc"
+	TypeCC14          MappingType = "cc14"
+	TypeNRPN          MappingType = "nrpn"
+	TypePitchBend     MappingType = "pitchbend"
+	TypeNote          MappingType = "note"           // Note On above half travel, Note Off below
+	TypeProgramChange MappingType = "program_change" // Sends program Number when pressed
+	TypeAfterTouch    MappingType = "aftertouch"
+	TypePreset        MappingType = "preset" // Switches to Preset when pressed, or to the next preset if empty
+)
+
+// Mapping describes what one control of one module sends.
+type Mapping struct {
+	ModuleID  uint8       `json:"module_id"`
+	ControlID uint8       `json:"control_id"`
+	Name      string      `json:"name,omitempty"`
+	Type      MappingType `json:"type"`
+	Channel   uint8       `json:"channel"` // 0-15
+	Number    uint16      `json:"number"`  // CC, note, NRPN parameter or program number
+	// Output range in the units of Type (0-127 for 7-bit types, 0-16383 for 14-bit types).
+	// Max 0 means the top of the range, so leaving both at 0 uses the full range. Use
+	// Invert rather than Min above Max to reverse the direction.
+	Min    int    `json:"min"`
+	Max    int    `json:"max"`
+	Invert bool   `json:"invert,omitempty"`
+	Curve  string `json:"curve,omitempty"` // Empty or one of the Curve constants
+	// Output values of the table curve from 0 to 1, spread evenly over the travel
+	CurveTable []float64 `json:"curve_table,omitempty"`
+	Filter     *Filter   `json:"filter,omitempty"` // Smoothing of noisy analog controls
+	// What encoder movements send: empty for absolute or one of the Encoder constants
+	Encoder      string  `json:"encoder,omitempty"`
+	EncoderSteps int     `json:"encoder_steps,omitempty"` // Detents from minimum to maximum in absolute mode, 0 for 127
+	Acceleration float64 `json:"acceleration,omitempty"`  // Extra factor for fast turns, 0 is off
+	Button       *Button `json:"button,omitempty"`        // Toggle, radio, long press and double tap
+	Preset       string  `json:"preset,omitempty"`        // Target of preset mappings
+	// Output ports the messages go to, by name or port path from midi_ports.json.
+	// Empty sends to every open port.
+	Ports []string `json:"ports,omitempty"`
+}
+
+// Preset is a named set of mappings, e.g. one for DJing and one for a lighting show.
+type Preset struct {
+	Name     string    `json:"name"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// MappingFile is the content of control_mappings.json.
+type MappingFile struct {
+	Version      int      `json:"version"`
+	ActivePreset string   `json:"active_preset"`
+	Presets      []Preset `json:"presets"`
+}
+
+// mappingFileV1 is the layout of version 1 files.
+type mappingFileV1 struct {
+	Version  int       `json:"version"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Defaults decide what unmapped controls send: Control Change (or the configured mode)
+// with the control ID as number.
+type Defaults struct {
+	Channel uint8
+	Mode    midiOutputPipeline.OutputMode
+	Modes   map[uint8]midiOutputPipeline.OutputMode // Per control ID overrides of Mode
+}
+
+type controlKey struct {
+	module  uint8
+	control uint8
+}
+
+// mappingTable is never modified after it was published, edits publish a new table.
+type mappingTable struct {
+	file   MappingFile
+	active int // Index of the active preset in file.Presets
+	index  map[controlKey]Mapping
+}
+
+var (
+	rootPath = getvalues.FindRootPath()
+	dirPath  = filepath.Join(rootPath, "midiUtility")
+	FilePath = filepath.Join(dirPath, "control_mappings.json")
+
+	current      atomic.Pointer[mappingTable]
+	tableChanged = make(chan struct{}, 1) // Wakes MappingEngine after a new table was published
+	editMu       sync.Mutex               // Serialises edits and file writes
+	defaults     = Defaults{Mode: midiOutputPipeline.ModeCC}
+)
+
+func init() {
+	current.Store(newMappingTable(MappingFile{Version: MappingFileVersion}))
+}
+
+// Errors of edits the HTTP API answers differently from invalid requests.
+var (
+	ErrUnknownPreset = errors.New("no preset named")
+	ErrSaveFailed    = errors.New("failed to save mappings")
+)
+
+// publish atomically replaces the table used by MappingEngine.
+func publish(t *mappingTable) {
+	current.Store(t)
+	select {
+	case tableChanged <- struct{}{}:
+	default:
+	}
+}
+
+// SetDefaults sets the behaviour of unmapped controls. Call it before starting MappingEngine.
+func SetDefaults(d Defaults) {
+	defaults = d
+}
+
+// fullScale returns the largest output value of a mapping type.
+func (t MappingType) fullScale() int {
+	switch t {
+	case TypeCC14, TypeNRPN, TypePitchBend:
+		return 16383
+	}
+	return 127
+}
+
+// Validate checks a mapping before it is stored.
+func (m Mapping) Validate() error {
+	switch m.Type {
+	case TypeCC, TypeNote, TypeProgramChange, TypeAfterTouch:
+		if m.Number > 127 {
+			return fmt.Errorf("number %d out of range (0-127)", m.Number)
+		}
+	case TypeCC14:
+		if m.Number > 31 {
+			return fmt.Errorf("14-bit CC needs a number between 0 and 31, got %d", m.Number)
+		}
+	case TypeNRPN:
+		if m.Number > 16383 {
+			return fmt.Errorf("NRPN parameter %d out of range (0-16383)", m.Number)
+		}
+	case TypePitchBend, TypePreset:
+	default:
+		return fmt.Errorf("unknown mapping type '%s'", m.Type)
+	}
+	if m.Channel > 15 {
+		return fmt.Errorf("channel %d out of range (0-15)", m.Channel)
+	}
+	if m.Min < 0 || m.Max < 0 || m.Min > m.Type.fullScale() || m.Max > m.Type.fullScale() {
+		return fmt.Errorf("output range %d-%d out of range (0-%d)", m.Min, m.Max, m.Type.fullScale())
+	}
+	if m.Max != 0 && m.Min > m.Max {
+		return fmt.Errorf("output range minimum %d above maximum %d, use invert to reverse the direction", m.Min, m.Max)
+	}
+	if err := m.validateCurve(); err != nil {
+		return err
+	}
+	if err := m.validateEncoder(); err != nil {
+		return err
+	}
+	if m.Button != nil {
+		if err := m.Button.Validate(m.Type); err != nil {
+			return err
+		}
+	}
+	if m.Filter != nil {
+		if err := m.Filter.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, port := range m.Ports {
+		if port == "" {
+			return fmt.Errorf("empty output port name")
+		}
+	}
+	return nil
+}
+
+// outputRange returns Min and Max as fractions of the full scale, Max 0 being the top.
+func (m Mapping) outputRange() (float64, float64) {
+	full := float64(m.Type.fullScale())
+	if m.Max == 0 {
+		return float64(m.Min) / full, 1
+	}
+	return float64(m.Min) / full, float64(m.Max) / full
+}
+
+func newMappingTable(file MappingFile) *mappingTable {
+	if len(file.Presets) == 0 {
+		file.Presets = []Preset{{Name: DefaultPresetName}}
+	}
+	t := &mappingTable{file: file}
+	for i, p := range file.Presets {
+		if p.Name == file.ActivePreset {
+			t.active = i
+		}
+	}
+	t.file.ActivePreset = file.Presets[t.active].Name
+
+	mappings := file.Presets[t.active].Mappings
+	t.index = make(map[controlKey]Mapping, len(mappings))
+	for _, m := range mappings {
+		t.index[controlKey{m.ModuleID, m.ControlID}] = m
+	}
+	return t
+}
+
+// copyFile returns a deep copy that can be edited without touching a published table.
+func copyFile(file MappingFile) MappingFile {
+	presets := make([]Preset, len(file.Presets))
+	for i, p := range file.Presets {
+		presets[i] = Preset{Name: p.Name, Mappings: append([]Mapping{}, p.Mappings...)}
+	}
+	file.Presets = presets
+	return file
+}
+
+// LoadMappings reads the mapping file. A missing file leaves the table empty.
+func LoadMappings() error {
+	editMu.Lock()
+	defer editMu.Unlock()
+
+	content, err := os.ReadFile(FilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	file, err := parseMappingFile(content)
+	if err != nil {
+		return err
+	}
+	publish(newMappingTable(file))
+	return nil
+}
+
+func parseMappingFile(content []byte) (MappingFile, error) {
+	var file MappingFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return MappingFile{}, fmt.Errorf("failed to parse mapping file JSON: %w", err)
+	}
+	if file.Version > MappingFileVersion {
+		return MappingFile{}, fmt.Errorf("mapping file version %d is newer than supported version %d", file.Version, MappingFileVersion)
+	}
+	if file.Version <= 1 {
+		// Unversioned files have the layout of version 1
+		var v1 mappingFileV1
+		if err := json.Unmarshal(content, &v1); err != nil {
+			return MappingFile{}, fmt.Errorf("failed to parse version 1 mapping file JSON: %w", err)
+		}
+		file = MappingFile{
+			ActivePreset: DefaultPresetName,
+			Presets:      []Preset{{Name: DefaultPresetName, Mappings: v1.Mappings}},
+		}
+	}
+	file.Version = MappingFileVersion
+
+	names := make(map[string]bool, len(file.Presets))
+	for _, p := range file.Presets {
+		if err := validatePresetName(p.Name); err != nil {
+			return MappingFile{}, err
+		}
+		if names[p.Name] {
+			return MappingFile{}, fmt.Errorf("duplicate preset '%s'", p.Name)
+		}
+		names[p.Name] = true
+		if err := validateMappings(p.Mappings); err != nil {
+			return MappingFile{}, fmt.Errorf("preset '%s': %w", p.Name, err)
+		}
+	}
+	return file, nil
+}
+
+func validateMappings(mappings []Mapping) error {
+	seen := make(map[controlKey]bool, len(mappings))
+	for _, m := range mappings {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("mapping for module %d control %d: %w", m.ModuleID, m.ControlID, err)
+		}
+		key := controlKey{m.ModuleID, m.ControlID}
+		if seen[key] {
+			return fmt.Errorf("duplicate mapping for module %d control %d", m.ModuleID, m.ControlID)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Mappings returns a copy of the active preset.
+func Mappings() Preset {
+	t := current.Load()
+	p := t.file.Presets[t.active]
+	return Preset{Name: p.Name, Mappings: append([]Mapping{}, p.Mappings...)}
+}
+
+// SetMapping adds a mapping to the active preset or replaces the one of the same control,
+// then saves the file.
+func SetMapping(m Mapping) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	return editActivePreset(func(p *Preset) error {
+		for i, existing := range p.Mappings {
+			if existing.ModuleID == m.ModuleID && existing.ControlID == m.ControlID {
+				p.Mappings[i] = m
+				return nil
+			}
+		}
+		p.Mappings = append(p.Mappings, m)
+		return nil
+	})
+}
+
+// DeleteMapping removes the mapping of a control from the active preset, which then
+// falls back to the defaults.
+func DeleteMapping(moduleID, controlID uint8) error {
+	return editActivePreset(func(p *Preset) error {
+		for i, existing := range p.Mappings {
+			if existing.ModuleID == moduleID && existing.ControlID == controlID {
+				p.Mappings = append(p.Mappings[:i], p.Mappings[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("no mapping for module %d control %d", moduleID, controlID)
+	})
+}
+
+// ReplaceMappings swaps in a complete set of mappings for the active preset.
+func ReplaceMappings(mappings []Mapping) error {
+	if err := validateMappings(mappings); err != nil {
+		return err
+	}
+	return editActivePreset(func(p *Preset) error {
+		p.Mappings = append([]Mapping{}, mappings...)
+		return nil
+	})
+}
+
+func editActivePreset(change func(p *Preset) error) error {
+	return edit(func(file *MappingFile, active int) error {
+		return change(&file.Presets[active])
+	})
+}
+
+// edit applies change to a copy of the current file, saves it and publishes the result.
+func edit(change func(file *MappingFile, active int) error) error {
+	editMu.Lock()
+	defer editMu.Unlock()
+
+	t := current.Load()
+	file := copyFile(t.file)
+	if err := change(&file, t.active); err != nil {
+		return err
+	}
+	file.Version = MappingFileVersion
+
+	if err := writeMappingFile(file); err != nil {
+		return fmt.Errorf("%w: %w", ErrSaveFailed, err)
+	}
+	publish(newMappingTable(file))
+	return nil
+}
+
+func writeMappingFile(file MappingFile) error {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mapping file: %w", err)
+	}
+
+	// Write next to the file and rename, so a crash never leaves a half written file
+	tmpPath := FilePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write mapping file: %w", err)
+	}
+	return os.Rename(tmpPath, FilePath)
+}
@@ -0,0 +1,132 @@
+package controlmapping
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMappingFileMigration(t *testing.T) {
+	fader := Mapping{ModuleID: 3, ControlID: 1, Type: TypeCC, Number: 7}
+	knob := Mapping{ModuleID: 3, ControlID: 2, Type: TypeNRPN, Number: 300}
+
+	tests := []struct {
+		name    string
+		content string
+		want    MappingFile
+	}{
+		{
+			name: "unversioned file",
+			content: `{"mappings": [
+				{"module_id": 3, "control_id": 1, "type": "cc", "number": 7},
+				{"module_id": 3, "control_id": 2, "type": "nrpn", "number": 300}
+			]}`,
+			want: MappingFile{
+				Version:      MappingFileVersion,
+				ActivePreset: DefaultPresetName,
+				Presets:      []Preset{{Name: DefaultPresetName, Mappings: []Mapping{fader, knob}}},
+			},
+		},
+		{
+			name:    "version 1",
+			content: `{"version": 1, "mappings": [{"module_id": 3, "control_id": 1, "type": "cc", "number": 7}]}`,
+			want: MappingFile{
+				Version:      MappingFileVersion,
+				ActivePreset: DefaultPresetName,
+				Presets:      []Preset{{Name: DefaultPresetName, Mappings: []Mapping{fader}}},
+			},
+		},
+		{
+			name: "version 2 is kept",
+			content: `{"version": 2, "active_preset": "live", "presets": [
+				{"name": "studio", "mappings": [{"module_id": 3, "control_id": 1, "type": "cc", "number": 7}]},
+				{"name": "live", "mappings": []}
+			]}`,
+			want: MappingFile{
+				Version:      MappingFileVersion,
+				ActivePreset: "live",
+				Presets: []Preset{
+					{Name: "studio", Mappings: []Mapping{fader}},
+					{Name: "live", Mappings: []Mapping{}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMappingFile([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("parseMappingFile: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMappingFile = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMappingFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"newer version", `{"version": 99}`, "newer than supported"},
+		{"invalid JSON", `{"version": 2,`, "failed to parse"},
+		{"duplicate preset", `{"version": 2, "presets": [{"name": "a"}, {"name": "a"}]}`, "duplicate preset"},
+		{"empty preset name", `{"version": 2, "presets": [{"name": " "}]}`, "must not be empty"},
+		{
+			name:    "duplicate mapping in version 1",
+			content: `{"mappings": [{"module_id": 1, "control_id": 1, "type": "cc"}, {"module_id": 1, "control_id": 1, "type": "cc"}]}`,
+			err:     "duplicate mapping",
+		},
+		{
+			name:    "invalid mapping",
+			content: `{"version": 2, "presets": [{"name": "a", "mappings": [{"module_id": 1, "control_id": 1, "type": "cc", "number": 200}]}]}`,
+			err:     "preset 'a'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMappingFile([]byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseMappingFile error = %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMappingOutputRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Mapping
+		lo, hi  float64
+		invalid bool
+	}{
+		{name: "full range", m: Mapping{Type: TypeCC}, lo: 0, hi: 1},
+		{name: "missing max is full scale", m: Mapping{Type: TypeCC, Min: 127}, lo: 1, hi: 1},
+		{name: "narrowed", m: Mapping{Type: TypeNRPN, Min: 0, Max: 16383}, lo: 0, hi: 1},
+		{name: "min above max", m: Mapping{Type: TypeCC, Min: 100, Max: 20}, invalid: true},
+		{name: "out of range", m: Mapping{Type: TypeCC, Max: 128}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.Validate()
+			if tt.invalid {
+				if err == nil {
+					t.Fatal("Validate accepted an invalid range")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if lo, hi := tt.m.outputRange(); lo != tt.lo || hi != tt.hi {
+				t.Errorf("outputRange = %g-%g, want %g-%g", lo, hi, tt.lo, tt.hi)
+			}
+		})
+	}
+}
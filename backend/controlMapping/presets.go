@@ -0,0 +1,95 @@
+package controlmapping
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// PresetInfo summarises a preset for listings.
+type PresetInfo struct {
+	Name     string `json:"name"`
+	Mappings int    `json:"mappings"`
+	Active   bool   `json:"active"`
+}
+
+// Presets lists all presets in file order.
+func Presets() []PresetInfo {
+	t := current.Load()
+	list := make([]PresetInfo, 0, len(t.file.Presets))
+	for i, p := range t.file.Presets {
+		list = append(list, PresetInfo{
+			Name:     p.Name,
+			Mappings: len(p.Mappings),
+			Active:   i == t.active,
+		})
+	}
+	return list
+}
+
+// ActivePreset returns the name of the preset MappingEngine currently uses.
+func ActivePreset() string {
+	return current.Load().file.ActivePreset
+}
+
+// ActivatePreset switches MappingEngine to another preset. The switch is a single
+// atomic swap, events already turned into MIDI are sent unchanged.
+func ActivatePreset(name string) error {
+	err := edit(func(file *MappingFile, active int) error {
+		for _, p := range file.Presets {
+			if p.Name == name {
+				file.ActivePreset = name
+				return nil
+			}
+		}
+		return fmt.Errorf("%w '%s'", ErrUnknownPreset, name)
+	})
+	if err == nil {
+		log.Printf("Activated preset '%s'", name)
+	}
+	return err
+}
+
+// ActivateNextPreset switches to the preset after the active one, wrapping around.
+func ActivateNextPreset() error {
+	return ActivatePreset(nextPresetName())
+}
+
+// DuplicatePreset copies the mappings of preset from into a new preset named to.
+func DuplicatePreset(from string, to string) error {
+	if err := validatePresetName(to); err != nil {
+		return err
+	}
+	return edit(func(file *MappingFile, active int) error {
+		var source *Preset
+		for i := range file.Presets {
+			if file.Presets[i].Name == to {
+				return fmt.Errorf("preset '%s' already exists", to)
+			}
+			if file.Presets[i].Name == from {
+				source = &file.Presets[i]
+			}
+		}
+		if source == nil {
+			return fmt.Errorf("%w '%s'", ErrUnknownPreset, from)
+		}
+		file.Presets = append(file.Presets, Preset{
+			Name:     to,
+			Mappings: append([]Mapping{}, source.Mappings...),
+		})
+		return nil
+	})
+}
+
+// nextPresetName returns the preset after the active one, wrapping around.
+func nextPresetName() string {
+	t := current.Load()
+	return t.file.Presets[(t.active+1)%len(t.file.Presets)].Name
+}
+
+func validatePresetName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("preset name must not be empty")
+	}
+	return nil
+}
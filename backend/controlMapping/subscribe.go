@@ -0,0 +1,30 @@
+package controlmapping
+
+import (
+	"modularMidiGoApp/backend/fanout"
+)
+
+var (
+	inputEvents fanout.Fanout[ControlEvent]
+	valueEvents fanout.Fanout[ControlEvent]
+)
+
+// PublishInput passes an event on to SubscribeInputs subscribers. Transports call it for
+// every event they read, before handing it to MappingEngine.
+func PublishInput(ev ControlEvent) {
+	inputEvents.Publish(ev)
+}
+
+// SubscribeInputs returns a channel receiving every control event as the transports read
+// it, including readings the filters of the mapping drop. Call cancel when done.
+func SubscribeInputs() (events <-chan ControlEvent, cancel func()) {
+	return inputEvents.Subscribe(256)
+}
+
+// SubscribeValues returns a channel receiving every control event MappingEngine handles,
+// e.g. to send the values over OSC as well. Value is the value after the filters of the
+// mapping, or the position of an absolute encoder, Delta is only set for relative
+// encoders. Call cancel when done.
+func SubscribeValues() (events <-chan ControlEvent, cancel func()) {
+	return valueEvents.Subscribe(256)
+}
@@ -0,0 +1,38 @@
+package dmxUtility
+
+import "encoding/binary"
+
+// ArtNetPort is the UDP port Art-Net nodes listen on.
+const ArtNetPort = 6454
+
+// artNetID starts every Art-Net packet.
+const artNetID = "Art-Net\x00"
+
+const (
+	opDmx          = 0x5000
+	artNetProtocol = 14
+)
+
+// ArtDmxPacket builds an ArtDmx packet with the channel values of one universe. Universe is
+// the 15-bit port address (net, sub-net and universe), sequence 1-255 lets receivers put
+// packets back in order, 0 disables that.
+//
+//	| "Art-Net\0" | OpCode LE | ProtVer BE | sequence | physical | port address LE | length BE | data |
+func ArtDmxPacket(universe uint16, sequence uint8, data []byte) []byte {
+	// The length has to be even, between 2 and 512
+	length := len(data) + len(data)%2
+	length = max(2, min(DMXChannels, length))
+
+	packet := make([]byte, 0, 18+length)
+	packet = append(packet, artNetID...)
+	packet = binary.LittleEndian.AppendUint16(packet, opDmx)
+	packet = binary.BigEndian.AppendUint16(packet, artNetProtocol)
+	packet = append(packet, sequence, 0)
+	packet = binary.LittleEndian.AppendUint16(packet, universe&0x7FFF)
+	packet = binary.BigEndian.AppendUint16(packet, uint16(length))
+	packet = append(packet, data[:min(len(data), length)]...)
+	for len(packet) < 18+length {
+		packet = append(packet, 0)
+	}
+	return packet
+}
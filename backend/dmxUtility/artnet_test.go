@@ -0,0 +1,56 @@
+package dmxUtility
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestArtDmxPacketLayout(t *testing.T) {
+	packet := ArtDmxPacket(0x1234, 7, []byte{10, 20, 30})
+
+	want := []byte{
+		'A', 'r', 't', '-', 'N', 'e', 't', 0,
+		0x00, 0x50, // OpDmx, little endian
+		0x00, 0x0E, // Protocol version 14, big endian
+		7,          // Sequence
+		0,          // Physical
+		0x34, 0x12, // Port address, little endian
+		0x00, 0x04, // Length, big endian and rounded up to even
+		10, 20, 30, 0,
+	}
+	if !bytes.Equal(packet, want) {
+		t.Errorf("ArtDmxPacket = % x, want % x", packet, want)
+	}
+}
+
+func TestArtDmxPacketLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		length   int
+	}{
+		{"empty is padded to the minimum", 0, 2},
+		{"odd is rounded up", 5, 6},
+		{"full universe", DMXChannels, DMXChannels},
+		{"extra channels are cut", DMXChannels + 10, DMXChannels},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := ArtDmxPacket(1, 0, make([]byte, tt.channels))
+			if len(packet) != 18+tt.length {
+				t.Fatalf("packet has %d bytes, want %d", len(packet), 18+tt.length)
+			}
+			if got := int(packet[16])<<8 | int(packet[17]); got != tt.length {
+				t.Errorf("length field = %d, want %d", got, tt.length)
+			}
+		})
+	}
+}
+
+func TestArtDmxPacketUniverseIs15Bit(t *testing.T) {
+	packet := ArtDmxPacket(0xFFFF, 0, nil)
+	if packet[14] != 0xFF || packet[15] != 0x7F {
+		t.Errorf("port address = % x, want ff 7f", packet[14:16])
+	}
+}
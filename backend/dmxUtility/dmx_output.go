@@ -0,0 +1,202 @@
+package dmxUtility
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"time"
+
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+)
+
+// DMXChannels is the number of channels of a universe.
+const DMXChannels = 512
+
+// Protocols DMX can be sent with.
+const (
+	ProtocolArtNet = "artnet"
+	ProtocolSACN   = "sacn"
+)
+
+// ControlKey identifies a control by module ID and control ID.
+type ControlKey struct {
+	Module  uint8
+	Control uint8
+}
+
+// Channel is where a control is sent, 1-512. Fine is the channel of the low byte of
+// 16-bit values, 0 for 8-bit channels.
+type Channel struct {
+	Coarse int
+	Fine   int
+}
+
+// OutputConfig is the [dmx_output] section of modularMidi.conf.
+type OutputConfig struct {
+	Protocols []string // ProtocolArtNet and/or ProtocolSACN
+	// Art-Net counts universes from 0 and sACN from 1, so the first universe is
+	// ArtNetUniverse 0 and SACNUniverse 1. Both are set separately to fit any numbering.
+	ArtNetUniverse uint16  // Port address, 0-32767
+	SACNUniverse   uint16  // 1-63999
+	ArtNetTarget   string  // host:port
+	SACNTarget     string  // host:port, empty for the multicast group of SACNUniverse
+	RefreshRate    float64 // Packets per second, also sent when nothing changed
+	Source         SACNSource
+	Channels       map[ControlKey]Channel
+}
+
+// DefaultOutputConfig is used for keys missing in the configuration.
+var DefaultOutputConfig = OutputConfig{
+	Protocols:      []string{ProtocolArtNet},
+	ArtNetUniverse: 0,
+	SACNUniverse:   1,
+	ArtNetTarget:   fmt.Sprintf("127.0.0.1:%d", ArtNetPort),
+	RefreshRate:    30,
+	Source:         SACNSource{Name: "Modular MIDI Controller", Priority: 100},
+}
+
+// Validate checks the configuration before DMXSender is started.
+func (c OutputConfig) Validate() error {
+	if len(c.Protocols) == 0 {
+		return fmt.Errorf("no DMX protocol")
+	}
+	for _, p := range c.Protocols {
+		switch p {
+		case ProtocolArtNet:
+			if c.ArtNetUniverse > 0x7FFF {
+				return fmt.Errorf("Art-Net universe %d out of range (0-32767)", c.ArtNetUniverse)
+			}
+		case ProtocolSACN:
+			if c.SACNUniverse < 1 || c.SACNUniverse > 63999 {
+				return fmt.Errorf("sACN universe %d out of range (1-63999)", c.SACNUniverse)
+			}
+		default:
+			return fmt.Errorf("unknown DMX protocol '%s' (use %s or %s)", p, ProtocolArtNet, ProtocolSACN)
+		}
+	}
+	if c.RefreshRate <= 0 || c.RefreshRate > 44 {
+		return fmt.Errorf("refresh rate %g out of range (above 0, at most 44)", c.RefreshRate)
+	}
+	if c.Source.Priority > 200 {
+		return fmt.Errorf("sACN priority %d out of range (0-200)", c.Source.Priority)
+	}
+
+	used := make(map[int]ControlKey)
+	for key, ch := range c.Channels {
+		channels := []int{ch.Coarse}
+		if ch.Fine != 0 {
+			channels = append(channels, ch.Fine)
+		}
+		for _, n := range channels {
+			if n < 1 || n > DMXChannels {
+				return fmt.Errorf("DMX channel %d of module %d control %d out of range (1-%d)", n, key.Module, key.Control, DMXChannels)
+			}
+			if other, ok := used[n]; ok {
+				return fmt.Errorf("DMX channel %d used by module %d control %d and module %d control %d", n, other.Module, other.Control, key.Module, key.Control)
+			}
+			used[n] = key
+		}
+	}
+	return nil
+}
+
+// dmxTarget is one receiver. Failures are logged once until sending works again.
+type dmxTarget struct {
+	protocol string
+	address  string
+	conn     *net.UDPConn
+	sequence uint8
+	failing  bool
+}
+
+// DMXSender sets the configured DMX channels to the values of their controls and sends
+// the universe RefreshRate times a second over Art-Net and/or sACN.
+func DMXSender(conf OutputConfig, stopChan <-chan struct{}) {
+	if _, err := rand.Read(conf.Source.CID[:]); err != nil {
+		log.Printf("Failed to create sACN CID: %v", err)
+		return
+	}
+
+	var targets []*dmxTarget
+	for _, protocol := range conf.Protocols {
+		address, universe := conf.ArtNetTarget, conf.ArtNetUniverse
+		if protocol == ProtocolSACN {
+			address, universe = conf.SACNTarget, conf.SACNUniverse
+			if address == "" {
+				address = SACNMulticastAddress(universe)
+			}
+		}
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			log.Printf("Failed to resolve %s target %s: %v", protocol, address, err)
+			continue
+		}
+		conn, err := net.DialUDP("udp", nil, addr)
+		if err != nil {
+			log.Printf("Failed to open %s target %s: %v", protocol, address, err)
+			continue
+		}
+		defer conn.Close()
+		targets = append(targets, &dmxTarget{protocol: protocol, address: address, conn: conn})
+		log.Printf("Sending DMX universe %d over %s to %s", universe, protocol, address)
+	}
+	if len(targets) == 0 {
+		log.Println("No DMX targets available, DMX output disabled")
+		return
+	}
+
+	events, cancel := controlmapping.SubscribeValues()
+	defer cancel()
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / conf.RefreshRate))
+	defer ticker.Stop()
+
+	var data [DMXChannels]byte
+	for {
+		select {
+		case <-stopChan:
+			return
+		case ev := <-events:
+			ch, ok := conf.Channels[ControlKey{ev.ModuleID, ev.ControlID}]
+			if ok && ev.Delta == 0 {
+				ch.set(&data, ev.Value)
+			}
+		case <-ticker.C:
+			for _, t := range targets {
+				t.send(conf, data[:])
+			}
+		}
+	}
+}
+
+// set writes a normalized value to the channel, split into high and low byte for 16-bit channels.
+func (ch Channel) set(data *[DMXChannels]byte, value float64) {
+	value = math.Max(0, math.Min(1, value))
+	if ch.Fine == 0 {
+		data[ch.Coarse-1] = byte(math.Round(value * 255))
+		return
+	}
+	v := uint16(math.Round(value * 65535))
+	data[ch.Coarse-1] = byte(v >> 8)
+	data[ch.Fine-1] = byte(v)
+}
+
+func (t *dmxTarget) send(conf OutputConfig, data []byte) {
+	var packet []byte
+	if t.protocol == ProtocolSACN {
+		packet = SACNPacket(conf.Source, conf.SACNUniverse, t.sequence, data)
+		t.sequence++
+	} else {
+		// 0 means the receiver ignores the sequence, so Art-Net counts 1-255
+		t.sequence = t.sequence%255 + 1
+		packet = ArtDmxPacket(conf.ArtNetUniverse, t.sequence, data)
+	}
+
+	_, err := t.conn.Write(packet)
+	if err != nil && !t.failing {
+		log.Printf("Failed to send %s to %s: %v", t.protocol, t.address, err)
+	}
+	t.failing = err != nil
+}
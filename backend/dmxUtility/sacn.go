@@ -0,0 +1,72 @@
+package dmxUtility
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// SACNPort is the UDP port sACN (E1.31) receivers listen on.
+const SACNPort = 5568
+
+// acnPacketID identifies the root layer of every sACN packet.
+const acnPacketID = "ASC-E1.17\x00\x00\x00"
+
+const (
+	vectorRootData    = 0x00000004
+	vectorFramingData = 0x00000002
+	vectorDMPSetProp  = 0x02
+	sacnHeaderLength  = 126 // Root, framing and DMP layer up to the start code
+	sourceNameLength  = 64
+)
+
+// SACNSource identifies the sender in sACN packets.
+type SACNSource struct {
+	CID      [16]byte // UUID, the same for every packet of this sender
+	Name     string   // Shown by receivers, at most 63 bytes are sent
+	Priority uint8    // 0-200, receivers follow the source with the highest priority
+}
+
+// SACNPacket builds an E1.31 data packet with the channel values of one universe
+// (1-63999). Sequence should count up by one with every packet of the universe.
+func SACNPacket(source SACNSource, universe uint16, sequence uint8, data []byte) []byte {
+	data = data[:min(len(data), DMXChannels)]
+	total := sacnHeaderLength + len(data)
+	flagsAndLength := func(from int) uint16 {
+		return 0x7000 | uint16(total-from)
+	}
+
+	packet := make([]byte, 0, total)
+
+	// Root layer
+	packet = binary.BigEndian.AppendUint16(packet, 0x0010) // Preamble size
+	packet = binary.BigEndian.AppendUint16(packet, 0x0000) // Postamble size
+	packet = append(packet, acnPacketID...)
+	packet = binary.BigEndian.AppendUint16(packet, flagsAndLength(16))
+	packet = binary.BigEndian.AppendUint32(packet, vectorRootData)
+	packet = append(packet, source.CID[:]...)
+
+	// Framing layer
+	packet = binary.BigEndian.AppendUint16(packet, flagsAndLength(38))
+	packet = binary.BigEndian.AppendUint32(packet, vectorFramingData)
+	name := make([]byte, sourceNameLength)
+	copy(name[:sourceNameLength-1], source.Name)
+	packet = append(packet, name...)
+	packet = append(packet, source.Priority)
+	packet = binary.BigEndian.AppendUint16(packet, 0) // Synchronization address, unused
+	packet = append(packet, sequence, 0)              // Sequence and options
+	packet = binary.BigEndian.AppendUint16(packet, universe)
+
+	// DMP layer
+	packet = binary.BigEndian.AppendUint16(packet, flagsAndLength(115))
+	packet = append(packet, vectorDMPSetProp, 0xA1)                     // Vector, address and data type
+	packet = binary.BigEndian.AppendUint16(packet, 0x0000)              // First property address
+	packet = binary.BigEndian.AppendUint16(packet, 0x0001)              // Address increment
+	packet = binary.BigEndian.AppendUint16(packet, uint16(len(data)+1)) // Property value count
+	packet = append(packet, 0x00)                                       // DMX start code
+	return append(packet, data...)
+}
+
+// SACNMulticastAddress returns the multicast group receivers of a universe join.
+func SACNMulticastAddress(universe uint16) string {
+	return fmt.Sprintf("239.255.%d.%d:%d", universe>>8, universe&0xFF, SACNPort)
+}
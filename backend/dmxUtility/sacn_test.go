@@ -0,0 +1,99 @@
+package dmxUtility
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestSACNPacketLayout(t *testing.T) {
+	source := SACNSource{Name: "modularMidi", Priority: 100}
+	for i := range source.CID {
+		source.CID[i] = byte(i + 1)
+	}
+	data := make([]byte, DMXChannels)
+	data[0], data[511] = 0x11, 0x22
+
+	packet := SACNPacket(source, 0x1234, 9, data)
+	if len(packet) != 638 {
+		t.Fatalf("packet has %d bytes, want 638", len(packet))
+	}
+
+	u16 := func(offset int) uint16 { return binary.BigEndian.Uint16(packet[offset:]) }
+	u32 := func(offset int) uint32 { return binary.BigEndian.Uint32(packet[offset:]) }
+	fields := []struct {
+		name      string
+		got, want uint32
+	}{
+		{"preamble size", uint32(u16(0)), 0x0010},
+		{"postamble size", uint32(u16(2)), 0},
+		{"root flags and length", uint32(u16(16)), 0x726E},
+		{"root vector", u32(18), vectorRootData},
+		{"framing flags and length", uint32(u16(38)), 0x7258},
+		{"framing vector", u32(40), vectorFramingData},
+		{"priority", uint32(packet[108]), 100},
+		{"synchronization address", uint32(u16(109)), 0},
+		{"sequence", uint32(packet[111]), 9},
+		{"options", uint32(packet[112]), 0},
+		{"universe", uint32(u16(113)), 0x1234},
+		{"DMP flags and length", uint32(u16(115)), 0x720B},
+		{"DMP vector", uint32(packet[117]), vectorDMPSetProp},
+		{"address and data type", uint32(packet[118]), 0xA1},
+		{"first property address", uint32(u16(119)), 0},
+		{"address increment", uint32(u16(121)), 1},
+		{"property value count", uint32(u16(123)), 513},
+		{"start code", uint32(packet[125]), 0},
+		{"first channel", uint32(packet[126]), 0x11},
+		{"last channel", uint32(packet[637]), 0x22},
+	}
+	for _, f := range fields {
+		if f.got != f.want {
+			t.Errorf("%s = 0x%X, want 0x%X", f.name, f.got, f.want)
+		}
+	}
+
+	if got := string(packet[4:16]); got != acnPacketID {
+		t.Errorf("ACN packet identifier = %q", got)
+	}
+	if !bytes.Equal(packet[22:38], source.CID[:]) {
+		t.Errorf("CID = % x, want % x", packet[22:38], source.CID)
+	}
+	if name := string(bytes.TrimRight(packet[44:108], "\x00")); name != source.Name {
+		t.Errorf("source name = %q, want %q", name, source.Name)
+	}
+}
+
+func TestSACNPacketShortUniverse(t *testing.T) {
+	packet := SACNPacket(SACNSource{}, 1, 0, []byte{1, 2, 3})
+	if len(packet) != sacnHeaderLength+3 {
+		t.Fatalf("packet has %d bytes, want %d", len(packet), sacnHeaderLength+3)
+	}
+	if got := binary.BigEndian.Uint16(packet[123:]); got != 4 {
+		t.Errorf("property value count = %d, want 4", got)
+	}
+	if got := binary.BigEndian.Uint16(packet[16:]) & 0x0FFF; int(got) != len(packet)-16 {
+		t.Errorf("root length = %d, want %d", got, len(packet)-16)
+	}
+}
+
+func TestSACNSourceNameIsTerminated(t *testing.T) {
+	packet := SACNPacket(SACNSource{Name: strings.Repeat("x", 100)}, 1, 0, nil)
+	name := packet[44:108]
+	if name[62] != 'x' || name[63] != 0 {
+		t.Errorf("source name ends in % x, want 63 characters and a zero byte", name[60:])
+	}
+}
+
+func TestSACNMulticastAddress(t *testing.T) {
+	tests := map[uint16]string{
+		1:      "239.255.0.1:5568",
+		0x1234: "239.255.18.52:5568",
+		63999:  "239.255.249.255:5568",
+	}
+	for universe, want := range tests {
+		if got := SACNMulticastAddress(universe); got != want {
+			t.Errorf("SACNMulticastAddress(%d) = %s, want %s", universe, got, want)
+		}
+	}
+}
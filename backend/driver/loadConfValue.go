@@ -1,10 +1,19 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	dmxUtility "modularMidiGoApp/backend/dmxUtility"
 	getvalues "modularMidiGoApp/backend/getValues"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	oscUtility "modularMidiGoApp/backend/oscUtility"
+	usbUtility "modularMidiGoApp/backend/usbUtility"
+	"net"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
@@ -42,6 +51,16 @@ func LoadHTTPconf() string {
 	return returnStr
 }
 
+// LoadHTTPBindAddress reads [http] bind_address, the address the HTTP API listens on.
+// Without it only this computer can reach the API.
+func LoadHTTPBindAddress() string {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+	return strings.TrimSpace(cfg.Section("http").Key("bind_address").MustString("127.0.0.1"))
+}
+
 func LoadUDPconf() string {
 	cfg, err := ini.Load(confPath)
 	if err != nil {
@@ -67,3 +86,384 @@ func LoadUDPconf() string {
 	}, "")
 	return returnStr
 }
+
+// LoadSerialConf reads the [serial] section. Missing keys fall back to usbUtility.DefaultSerialConfig.
+func LoadSerialConf() usbUtility.SerialConfig {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	conf := usbUtility.DefaultSerialConfig
+	s := cfg.Section("serial")
+
+	conf.BaudRate = s.Key("baud_rate").MustInt(conf.BaudRate)
+	conf.DataBits = s.Key("data_bits").MustInt(conf.DataBits)
+
+	if s.HasKey("parity") {
+		parity, err := usbUtility.ParseParity(s.Key("parity").String())
+		if err != nil {
+			log.Fatalf("Invalid key [serial] parity: %v", err)
+		}
+		conf.Parity = parity
+	}
+	if s.HasKey("stop_bits") {
+		stopBits, err := usbUtility.ParseStopBits(s.Key("stop_bits").String())
+		if err != nil {
+			log.Fatalf("Invalid key [serial] stop_bits: %v", err)
+		}
+		conf.StopBits = stopBits
+	}
+
+	pollMs := s.Key("selection_poll_ms").MustInt(int(conf.SelectionPollInterval / time.Millisecond))
+	conf.SelectionPollInterval = time.Duration(pollMs) * time.Millisecond
+
+	return conf
+}
+
+// LoadInputTransports reads [input] transports and returns the enabled transports (usb, udp).
+func LoadInputTransports() []string {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	s := cfg.Section("input")
+	if !s.HasKey("transports") {
+		// Older config files only knew about USB
+		return []string{"usb"}
+	}
+
+	var transports []string
+	for _, transport := range s.Key("transports").Strings(",") {
+		transport = strings.ToLower(transport)
+		if transport != "usb" && transport != "udp" {
+			log.Fatalf("Invalid key [input] transports: unknown transport '%s'", transport)
+		}
+		transports = append(transports, transport)
+	}
+	return transports
+}
+
+// LoadInputRange reads the input range rangeKey (usb_range, udp_range) from [ranges].
+func LoadInputRange(rangeKey string) usbUtility.ValueRange {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	ranges := cfg.Section("ranges")
+	if !ranges.HasKey(rangeKey) {
+		return usbUtility.DefaultValueRange
+	}
+	inputRange, err := usbUtility.ParseValueRange(ranges.Key(rangeKey).String())
+	if err != nil {
+		log.Fatalf("Invalid key [ranges] %s: %v", rangeKey, err)
+	}
+	return inputRange
+}
+
+// LoadMappingDefaults reads [control_modes], which decides what unmapped controls send.
+func LoadMappingDefaults() controlmapping.Defaults {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	defaults := controlmapping.Defaults{
+		Mode:  midiOutputPipeline.ModeCC,
+		Modes: make(map[uint8]midiOutputPipeline.OutputMode),
+	}
+
+	for _, key := range cfg.Section("control_modes").Keys() {
+		mode, err := midiOutputPipeline.ParseOutputMode(key.String())
+		if err != nil {
+			log.Fatalf("Invalid key [control_modes] %s: %v", key.Name(), err)
+		}
+		if key.Name() == "default" {
+			defaults.Mode = mode
+			continue
+		}
+		control, err := strconv.ParseUint(key.Name(), 10, 8)
+		if err != nil {
+			log.Fatalf("Invalid key [control_modes] %s: expected a control ID", key.Name())
+		}
+		if mode == midiOutputPipeline.ModeCC14 && control > 31 {
+			log.Fatalf("Invalid key [control_modes] %s: cc14 needs a control ID between 0 and 31", key.Name())
+		}
+		defaults.Modes[uint8(control)] = mode
+	}
+
+	return defaults
+}
+
+// LoadModuleLeaveTimeout reads [modules] leave_timeout_ms, after which a silent module
+// counts as detached. 0 keeps modules until they leave or the connection is lost.
+func LoadModuleLeaveTimeout() time.Duration {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	s := cfg.Section("modules")
+	timeout := 5 * time.Second
+	if s.HasKey("leave_timeout_ms") {
+		ms := s.Key("leave_timeout_ms").MustInt(-1)
+		if ms < 0 {
+			log.Fatalf("Invalid key [modules] leave_timeout_ms: %s", s.Key("leave_timeout_ms").String())
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	return timeout
+}
+
+// LoadAutoMap reads [modules] auto_map, which maps the controls of newly described modules.
+func LoadAutoMap() bool {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+	return cfg.Section("modules").Key("auto_map").MustBool(true)
+}
+
+// LoadVirtualPortName reads [virtual_port] and returns the name of the virtual MIDI ports
+// to create, or "" when they are disabled.
+func LoadVirtualPortName() string {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	s := cfg.Section("virtual_port")
+	if !s.Key("enabled").MustBool(false) {
+		return ""
+	}
+	name := strings.TrimSpace(s.Key("name").MustString("Modular MIDI Controller"))
+	if name == "" {
+		log.Fatalf("Invalid key [virtual_port] name: must not be empty")
+	}
+	return name
+}
+
+// LoadWriterConfig reads [midi_output]. Missing keys fall back to midiOutputPipeline.DefaultWriterConfig.
+func LoadWriterConfig() midiOutputPipeline.WriterConfig {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	conf := midiOutputPipeline.DefaultWriterConfig
+	s := cfg.Section("midi_output")
+
+	if s.HasKey("rescan_ms") {
+		ms := s.Key("rescan_ms").MustInt(0)
+		if ms <= 0 {
+			log.Fatalf("Invalid key [midi_output] rescan_ms: %s", s.Key("rescan_ms").String())
+		}
+		conf.RescanInterval = time.Duration(ms) * time.Millisecond
+	}
+	if s.HasKey("disconnected_policy") {
+		policy, err := midiOutputPipeline.ParseDisconnectPolicy(s.Key("disconnected_policy").String())
+		if err != nil {
+			log.Fatalf("Invalid key [midi_output] disconnected_policy: %v", err)
+		}
+		conf.Policy = policy
+	}
+	conf.BufferSize = s.Key("buffer_size").MustInt(conf.BufferSize)
+
+	if s.HasKey("max_rate_hz") {
+		conf.MaxRate = s.Key("max_rate_hz").MustFloat64(-1)
+		if conf.MaxRate < 0 {
+			log.Fatalf("Invalid key [midi_output] max_rate_hz: %s", s.Key("max_rate_hz").String())
+		}
+	}
+
+	return conf
+}
+
+// LoadQueueConfig reads the queue keys of [midi_output]. Missing keys fall back to
+// midiOutputPipeline.DefaultQueueConfig.
+func LoadQueueConfig() midiOutputPipeline.QueueConfig {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	conf := midiOutputPipeline.DefaultQueueConfig
+	s := cfg.Section("midi_output")
+
+	if s.HasKey("queue_size") {
+		conf.Size = s.Key("queue_size").MustInt(0)
+		if conf.Size <= 0 {
+			log.Fatalf("Invalid key [midi_output] queue_size: %s", s.Key("queue_size").String())
+		}
+	}
+	if s.HasKey("queue_policy") {
+		policy, err := midiOutputPipeline.ParseQueuePolicy(s.Key("queue_policy").String())
+		if err != nil {
+			log.Fatalf("Invalid key [midi_output] queue_policy: %v", err)
+		}
+		conf.Policy = policy
+	}
+	if s.HasKey("block_timeout_ms") {
+		ms := s.Key("block_timeout_ms").MustInt(-1)
+		if ms < 0 {
+			log.Fatalf("Invalid key [midi_output] block_timeout_ms: %s", s.Key("block_timeout_ms").String())
+		}
+		conf.BlockTimeout = time.Duration(ms) * time.Millisecond
+	}
+
+	return conf
+}
+
+// LoadOSCOutputConfig reads [osc_output] and [osc_addresses]. It reports false if OSC
+// output is disabled.
+func LoadOSCOutputConfig() (oscUtility.OutputConfig, bool) {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	s := cfg.Section("osc_output")
+	if !s.Key("enabled").MustBool(false) {
+		return oscUtility.OutputConfig{}, false
+	}
+
+	conf := oscUtility.OutputConfig{
+		Address:   s.Key("address").MustString(oscUtility.DefaultAddress),
+		Addresses: make(map[oscUtility.ControlKey]string),
+	}
+	for _, target := range strings.Split(s.Key("targets").String(), ",") {
+		if target = strings.TrimSpace(target); target != "" {
+			conf.Targets = append(conf.Targets, target)
+		}
+	}
+
+	// Per control addresses, <module ID>.<control ID> = <address>
+	for _, key := range cfg.Section("osc_addresses").Keys() {
+		module, control, ok := strings.Cut(key.Name(), ".")
+		moduleID, err1 := strconv.ParseUint(module, 10, 8)
+		controlID, err2 := strconv.ParseUint(control, 10, 8)
+		if !ok || err1 != nil || err2 != nil {
+			log.Fatalf("Invalid key [osc_addresses] %s: expected <module ID>.<control ID>", key.Name())
+		}
+		conf.Addresses[oscUtility.ControlKey{Module: uint8(moduleID), Control: uint8(controlID)}] = key.String()
+	}
+
+	if err := conf.Validate(); err != nil {
+		log.Fatalf("Invalid section [osc_output]: %v", err)
+	}
+	return conf, true
+}
+
+// LoadOSCInputPort reads [osc_input]. It reports false if the OSC listener is disabled.
+func LoadOSCInputPort() (string, bool) {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	s := cfg.Section("osc_input")
+	if !s.Key("enabled").MustBool(false) {
+		return "", false
+	}
+	port := s.Key("listen_port").MustInt(0)
+	if port <= 0 || port > 65535 {
+		log.Fatalf("Invalid key [osc_input] listen_port: %s", s.Key("listen_port").String())
+	}
+	return strconv.Itoa(port), true
+}
+
+// LoadDMXOutputConfig reads [dmx_output] and [dmx_channels]. Missing keys fall back to
+// dmxUtility.DefaultOutputConfig. It reports false if DMX output is disabled.
+func LoadDMXOutputConfig() (dmxUtility.OutputConfig, bool) {
+	cfg, err := ini.Load(confPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+
+	s := cfg.Section("dmx_output")
+	if !s.Key("enabled").MustBool(false) {
+		return dmxUtility.OutputConfig{}, false
+	}
+
+	conf := dmxUtility.DefaultOutputConfig
+	conf.Channels = make(map[dmxUtility.ControlKey]dmxUtility.Channel)
+
+	if s.HasKey("protocols") {
+		conf.Protocols = nil
+		for _, p := range strings.Split(s.Key("protocols").String(), ",") {
+			if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+				conf.Protocols = append(conf.Protocols, p)
+			}
+		}
+	}
+	if s.HasKey("artnet_universe") {
+		universe := s.Key("artnet_universe").MustInt(-1)
+		if universe < 0 || universe > 0x7FFF {
+			log.Fatalf("Invalid key [dmx_output] artnet_universe: %s", s.Key("artnet_universe").String())
+		}
+		conf.ArtNetUniverse = uint16(universe)
+	}
+	if s.HasKey("sacn_universe") {
+		universe := s.Key("sacn_universe").MustInt(-1)
+		if universe < 1 || universe > 63999 {
+			log.Fatalf("Invalid key [dmx_output] sacn_universe: %s", s.Key("sacn_universe").String())
+		}
+		conf.SACNUniverse = uint16(universe)
+	}
+	if s.HasKey("artnet_target") {
+		conf.ArtNetTarget = withDefaultPort(s.Key("artnet_target").String(), dmxUtility.ArtNetPort)
+	}
+	if target := s.Key("sacn_target").String(); target != "" {
+		conf.SACNTarget = withDefaultPort(target, dmxUtility.SACNPort)
+	}
+	if s.HasKey("refresh_hz") {
+		conf.RefreshRate = s.Key("refresh_hz").MustFloat64(0)
+	}
+	conf.Source.Name = s.Key("source_name").MustString(conf.Source.Name)
+	if s.HasKey("priority") {
+		priority := s.Key("priority").MustInt(-1)
+		if priority < 0 || priority > 200 {
+			log.Fatalf("Invalid key [dmx_output] priority: %s", s.Key("priority").String())
+		}
+		conf.Source.Priority = uint8(priority)
+	}
+
+	// <module ID>.<control ID> = <channel>, or <coarse channel>,<fine channel> for 16-bit
+	for _, key := range cfg.Section("dmx_channels").Keys() {
+		module, control, ok := strings.Cut(key.Name(), ".")
+		moduleID, err1 := strconv.ParseUint(module, 10, 8)
+		controlID, err2 := strconv.ParseUint(control, 10, 8)
+		if !ok || err1 != nil || err2 != nil {
+			log.Fatalf("Invalid key [dmx_channels] %s: expected <module ID>.<control ID>", key.Name())
+		}
+
+		var ch dmxUtility.Channel
+		coarse, fine, is16Bit := strings.Cut(key.String(), ",")
+		ch.Coarse, err = strconv.Atoi(strings.TrimSpace(coarse))
+		if err == nil && is16Bit {
+			ch.Fine, err = strconv.Atoi(strings.TrimSpace(fine))
+			if ch.Fine == 0 {
+				err = fmt.Errorf("fine channel must not be 0")
+			}
+		}
+		if err != nil {
+			log.Fatalf("Invalid key [dmx_channels] %s: %s", key.Name(), key.String())
+		}
+		conf.Channels[dmxUtility.ControlKey{Module: uint8(moduleID), Control: uint8(controlID)}] = ch
+	}
+
+	if err := conf.Validate(); err != nil {
+		log.Fatalf("Invalid section [dmx_output]: %v", err)
+	}
+	return conf, true
+}
+
+// withDefaultPort adds port to addresses given as host only.
+func withDefaultPort(address string, port int) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(address, strconv.Itoa(port))
+}
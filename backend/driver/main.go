@@ -2,8 +2,15 @@ package main
 
 import (
 	"log"
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	dmxUtility "modularMidiGoApp/backend/dmxUtility"
 	httphandler "modularMidiGoApp/backend/httpHandler"
+	liveevents "modularMidiGoApp/backend/liveEvents"
+	midiInputPipeline "modularMidiGoApp/backend/midiUtility/midiInputPipeline"
 	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	oscUtility "modularMidiGoApp/backend/oscUtility"
+	udpUtility "modularMidiGoApp/backend/udpUtility"
 	usbUtility "modularMidiGoApp/backend/usbUtility"
 	"strings"
 )
@@ -11,9 +18,49 @@ import (
 // Executes first and prepares:
 // - Starts HTTP handler
 func main() {
+	virtualPort := LoadVirtualPortName()
+	midiOutputPipeline.SetVirtualPortName(virtualPort)
+	midiInputPipeline.SetVirtualPortName(virtualPort)
+	midiOutputPipeline.SetWriterConfig(LoadWriterConfig())
+	midiOutputPipeline.SetQueueConfig(LoadQueueConfig())
 	go midiOutputPipeline.MidiWriter()
-	stopUSBListener := make(chan struct{})
-	go usbUtility.ESP32MidiListener(0, midiOutputPipeline.MidiOutChannel, stopUSBListener)
+
+	controlmapping.SetDefaults(LoadMappingDefaults())
+	if err := controlmapping.LoadMappings(); err != nil {
+		log.Printf("Failed to load control mappings, using defaults: %v", err)
+	}
+	go controlmapping.MappingEngine(midiOutputPipeline.MidiOutChannel)
+
+	stopListeners := make(chan struct{})
+	go moduleregistry.ModuleWatcher(LoadModuleLeaveTimeout(), stopListeners)
+	go liveevents.Run(stopListeners)
+	if LoadAutoMap() {
+		go controlmapping.AutoMapper(stopListeners)
+	}
+
+	// Values the DAW sends back are shown on the modules
+	go midiInputPipeline.MidiReader(stopListeners)
+	go controlmapping.FeedbackEngine(midiInputPipeline.MidiInChannel)
+	if oscConf, ok := LoadOSCOutputConfig(); ok {
+		go oscUtility.OSCSender(oscConf, stopListeners)
+	}
+	if oscPort, ok := LoadOSCInputPort(); ok {
+		go oscUtility.OSCListener(oscPort, controlmapping.EventChannel, stopListeners)
+	}
+	if dmxConf, ok := LoadDMXOutputConfig(); ok {
+		go dmxUtility.DMXSender(dmxConf, stopListeners)
+	}
+	for _, transport := range LoadInputTransports() {
+		switch transport {
+		case "usb":
+			go usbUtility.ESP32MidiListener(LoadInputRange("usb_range"), LoadSerialConf(), controlmapping.EventChannel, stopListeners)
+		case "udp":
+			udpConf := LoadUDPconf()
+			port := parseConfValue(udpConf, "send_port")
+			devicePort := parseConfValue(udpConf, "listen_port")
+			go udpUtility.UDPMidiListener(port, devicePort, LoadInputRange("udp_range"), controlmapping.EventChannel, stopListeners)
+		}
+	}
 
 	go func() {
 		routes := []httphandler.Route{
@@ -21,10 +68,21 @@ func main() {
 			httphandler.UsbPortList,
 			httphandler.MidiTester,
 			httphandler.MidiPortList,
+			httphandler.SerialProtocolStats,
+			httphandler.UdpSenderList,
+			httphandler.ControlMappings,
+			httphandler.PresetList,
+			httphandler.ActivatePreset,
+			httphandler.DuplicatePreset,
+			httphandler.ModuleTopology,
+			httphandler.MidiOutputStatus,
+			httphandler.MidiOutputQueue,
+			httphandler.EventStream,
+			httphandler.EventSource,
 			// Add more routes
 		}
 		port := parsePort(LoadHTTPconf())
-		if err := httphandler.StartHTTPServer(port, routes); err != nil {
+		if err := httphandler.StartHTTPServer(LoadHTTPBindAddress(), port, routes); err != nil {
 			log.Fatalf("Failed to start HTTP server: %v", err)
 		}
 	}()
@@ -48,3 +106,14 @@ func parsePort(unparsed string) string {
 	}
 	return port
 }
+
+// parseConfValue returns the value of key from the strings built by LoadHTTPconf and LoadUDPconf.
+func parseConfValue(unparsed string, key string) string {
+	parts := strings.Split(strings.TrimSuffix(unparsed, ";"), ",")
+	for _, part := range parts {
+		if strings.HasPrefix(part, key+":") {
+			return strings.TrimPrefix(part, key+":")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+// Package fanout passes values on to any number of subscribers, for the events other
+// parts of the backend can follow such as control values, module changes and port status.
+package fanout
+
+import "sync"
+
+// Fanout sends every published value to all subscribers. Slow subscribers miss values
+// rather than blocking the publisher. The zero value is ready to use.
+type Fanout[T any] struct {
+	mu          sync.Mutex
+	subscribers map[chan T]struct{}
+}
+
+// Subscribe returns a channel with room for buffer values that receives everything
+// published from now on. cancel closes the channel, call it when done.
+func (f *Fanout[T]) Subscribe(buffer int) (values <-chan T, cancel func()) {
+	ch := make(chan T, buffer)
+
+	f.mu.Lock()
+	if f.subscribers == nil {
+		f.subscribers = make(map[chan T]struct{})
+	}
+	f.subscribers[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subscribers[ch]; ok {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends v to every subscriber with room for it.
+func (f *Fanout[T]) Publish(v T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	liveevents "modularMidiGoApp/backend/liveEvents"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// EventStream streams the live events of the backend as JSON over a WebSocket:
+//
+//	GET /events?module=<id>,...&type=<type>,...
+//
+// Both query parameters are optional and select modules and event types (control, midi,
+// module, port). Clients change the filter by sending a JSON object like
+// {"modules": [3], "types": ["midi"]}.
+var EventStream = Route{
+	Path: "/events",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		filter, err := eventFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		websocket.Server{
+			// Other web pages open in a browser must not read the events
+			Handshake: func(_ *websocket.Config, r *http.Request) error {
+				return checkOrigin(r)
+			},
+			Handler: func(ws *websocket.Conn) {
+				streamEvents(ws, filter)
+			},
+		}.ServeHTTP(w, r)
+	},
+}
+
+func streamEvents(ws *websocket.Conn, filter liveevents.Filter) {
+	sub := liveevents.Subscribe(filter)
+	defer sub.Close()
+
+	// Reading notices closed connections and new filters
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			var f liveevents.Filter
+			if err := websocket.JSON.Receive(ws, &f); err != nil {
+				return
+			}
+			sub.SetFilter(f)
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if err := websocket.JSON.Send(ws, ev); err != nil {
+				log.Printf("Event stream client %s gone: %v", ws.Request().RemoteAddr, err)
+				return
+			}
+		}
+	}
+}
+
+// EventSource streams the same events as EventStream as Server-Sent Events, for clients
+// without WebSocket:
+//
+//	GET /events/sse?module=<id>,...&type=<type>,...
+//
+// Each event is sent with its ID and the event JSON as data. Clients that reconnect with
+// the Last-Event-ID header, or the last_event_id query parameter, first get the events
+// they missed as long as they are still kept. If some are gone, a "missed" event is sent
+// before the replay, also when the ID is from before a restart of the backend.
+var EventSource = Route{
+	Path: "/events/sse",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		filter, err := eventFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		var sub *liveevents.Subscription
+		var replay []liveevents.Event
+		complete := true
+		if lastEventID != "" {
+			if sub, replay, complete, err = liveevents.SubscribeAfter(filter, lastEventID); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			sub = liveevents.Subscribe(filter)
+		}
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		if !complete {
+			missed, _ := json.Marshal(map[string]string{"after_id": lastEventID})
+			fmt.Fprintf(w, "event: missed\ndata: %s\n\n", missed)
+		}
+		for _, ev := range replay {
+			if err := writeSSE(w, ev); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		// Comments keep proxies from closing an idle stream
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case ev, ok := <-sub.Events:
+				if !ok {
+					return
+				}
+				if err := writeSSE(w, ev); err != nil {
+					log.Printf("Event stream client %s gone: %v", r.RemoteAddr, err)
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	},
+}
+
+func writeSSE(w http.ResponseWriter, ev liveevents.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", ev.ID, data)
+	return err
+}
+
+// eventFilter reads the module and type query parameters.
+func eventFilter(r *http.Request) (liveevents.Filter, error) {
+	var filter liveevents.Filter
+	for _, module := range splitQuery(r, "module") {
+		id, err := strconv.ParseUint(module, 10, 8)
+		if err != nil {
+			return filter, fmt.Errorf("query parameter 'module' must be numbers between 0 and 255")
+		}
+		filter.Modules = append(filter.Modules, uint8(id))
+	}
+	for _, t := range splitQuery(r, "type") {
+		switch t {
+		case liveevents.TypeControl, liveevents.TypeMidi, liveevents.TypeModule, liveevents.TypePort:
+			filter.Types = append(filter.Types, t)
+		default:
+			return filter, fmt.Errorf("unknown event type '%s'", t)
+		}
+	}
+	return filter, nil
+}
+
+// splitQuery returns the values of a query parameter given several times or comma separated.
+func splitQuery(r *http.Request, key string) []string {
+	var values []string
+	for _, v := range r.URL.Query()[key] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
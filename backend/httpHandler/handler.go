@@ -2,15 +2,22 @@ package httphandler
 
 import (
 	"fmt"
+	"mime"
 	midiCCOutputer "modularMidiGoApp/backend/midiUtility"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	"modularMidiGoApp/backend/udpUtility"
 	"modularMidiGoApp/backend/usbUtility"
+	"net"
 	"net/http"
+	"net/url"
 )
 
 // Route defines a mapping between a URL path and its handler function.
 type Route struct {
 	Path    string
 	Handler http.HandlerFunc
+	Methods []string // Allowed request methods, only GET when empty
 }
 
 var TestCallRoute = Route{
@@ -44,23 +51,100 @@ var MidiPortList = Route{
 	},
 }
 
+var MidiOutputStatus = Route{
+	Path: "/midiOutputStatus",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, midiOutputPipeline.OutputStatus())
+	},
+}
+
+var MidiOutputQueue = Route{
+	Path: "/midiOutputQueue",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, midiOutputPipeline.OutputQueueStats())
+	},
+}
+
+var SerialProtocolStats = Route{
+	Path: "/serialProtocolStats",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, usbUtility.ProtocolStats())
+	},
+}
+
+var UdpSenderList = Route{
+	Path: "/udpSenders",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, udpUtility.Senders())
+	},
+}
+
+var ModuleTopology = Route{
+	Path: "/moduleTopology",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, moduleregistry.GetTopology())
+	},
+}
+
 // Package httphandler provides functionality to start an HTTP server with specific routes
 
-// StartHTTPServer starts an HTTP server on the given port and uses the provided routes for GET requests.
-func StartHTTPServer(port string, routes []Route) error {
+// StartHTTPServer starts an HTTP server on host and port and uses the provided routes.
+// Routes without Methods only accept GET requests. Requests that change something must
+// pass checkWrite.
+func StartHTTPServer(host string, port string, routes []Route) error {
 	mux := http.NewServeMux()
 	for _, route := range routes {
-		// Wrap each handler to only allow GET requests
-		mux.HandleFunc(route.Path, func(handler http.HandlerFunc) http.HandlerFunc {
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{http.MethodGet}
+		}
+		// Wrap each handler to only allow the methods of the route
+		mux.HandleFunc(route.Path, func(handler http.HandlerFunc, methods []string) http.HandlerFunc {
 			return func(w http.ResponseWriter, r *http.Request) {
-				if r.Method == http.MethodGet {
+				for _, method := range methods {
+					if r.Method != method {
+						continue
+					}
+					if r.Method != http.MethodGet {
+						if err := checkWrite(r); err != nil {
+							http.Error(w, err.Error(), http.StatusForbidden)
+							return
+						}
+					}
 					handler(w, r)
-				} else {
-					http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+					return
 				}
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			}
-		}(route.Handler))
+		}(route.Handler, methods))
+	}
+	return http.ListenAndServe(net.JoinHostPort(host, port), mux)
+}
+
+// checkWrite keeps web pages open in the user's browser from changing the mappings.
+// Browsers can't send a JSON content type to another origin without asking first, and
+// send the Origin of the page with such requests.
+func checkWrite(r *http.Request) error {
+	if err := checkOrigin(r); err != nil {
+		return err
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return fmt.Errorf("requests changing the driver need Content-Type: application/json")
+	}
+	return nil
+}
+
+// checkOrigin accepts requests without Origin header, like the ones of the GUI and
+// scripts, and requests of pages served by this host.
+func checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return fmt.Errorf("origin %q not allowed", origin)
 	}
-	addr := fmt.Sprintf(":%s", port)
-	return http.ListenAndServe(addr, mux)
+	return nil
 }
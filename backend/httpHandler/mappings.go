@@ -0,0 +1,131 @@
+package httphandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	"net/http"
+	"strconv"
+)
+
+// ControlMappings reads and edits the mappings of the active preset:
+//
+//	GET    /mappings                          - the active preset
+//	POST   /mappings                          - add or replace one mapping (JSON body)
+//	PUT    /mappings                          - replace all mappings (preset as JSON body)
+//	DELETE /mappings?module=<id>&control=<id> - remove one mapping
+//
+// Like every request that changes something, POST, PUT and DELETE need
+// Content-Type: application/json, see checkWrite.
+var ControlMappings = Route{
+	Path:    "/mappings",
+	Methods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			var m controlmapping.Mapping
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				http.Error(w, fmt.Sprintf("invalid mapping JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := controlmapping.SetMapping(m); err != nil {
+				editError(w, err, http.StatusBadRequest)
+				return
+			}
+
+		case http.MethodPut:
+			var preset controlmapping.Preset
+			if err := json.NewDecoder(r.Body).Decode(&preset); err != nil {
+				http.Error(w, fmt.Sprintf("invalid preset JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := controlmapping.ReplaceMappings(preset.Mappings); err != nil {
+				editError(w, err, http.StatusBadRequest)
+				return
+			}
+
+		case http.MethodDelete:
+			moduleID, err := queryUint8(r, "module")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			controlID, err := queryUint8(r, "control")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := controlmapping.DeleteMapping(moduleID, controlID); err != nil {
+				editError(w, err, http.StatusNotFound)
+				return
+			}
+		}
+
+		writeJSON(w, controlmapping.Mappings())
+	},
+}
+
+var PresetList = Route{
+	Path: "/presets",
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, controlmapping.Presets())
+	},
+}
+
+// ActivatePreset switches to the preset given as ?name=<preset>. Like all changes it
+// needs Content-Type: application/json, see checkWrite.
+var ActivatePreset = Route{
+	Path:    "/activatePreset",
+	Methods: []string{http.MethodPost},
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		if err := controlmapping.ActivatePreset(r.URL.Query().Get("name")); err != nil {
+			editError(w, err, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, controlmapping.Presets())
+	},
+}
+
+// DuplicatePreset copies preset ?from=<preset> into a new preset ?to=<name>. Like all
+// changes it needs Content-Type: application/json, see checkWrite.
+var DuplicatePreset = Route{
+	Path:    "/duplicatePreset",
+	Methods: []string{http.MethodPost},
+	Handler: func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if err := controlmapping.DuplicatePreset(query.Get("from"), query.Get("to")); err != nil {
+			editError(w, err, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, controlmapping.Presets())
+	},
+}
+
+// editError answers a failed edit: 404 for unknown presets, 500 if the mapping file
+// couldn't be written and status for everything else.
+func editError(w http.ResponseWriter, err error, status int) {
+	switch {
+	case errors.Is(err, controlmapping.ErrUnknownPreset):
+		status = http.StatusNotFound
+	case errors.Is(err, controlmapping.ErrSaveFailed):
+		status = http.StatusInternalServerError
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// writeJSON sends v as the JSON response body.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func queryUint8(r *http.Request, key string) (uint8, error) {
+	value, err := strconv.ParseUint(r.URL.Query().Get(key), 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("query parameter '%s' must be a number between 0 and 255", key)
+	}
+	return uint8(value), nil
+}
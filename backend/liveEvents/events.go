@@ -0,0 +1,221 @@
+// Package liveevents merges what happens in the backend into one stream for live
+// monitoring: control values from the modules, every MIDI message sent, modules joining
+// and leaving, and MIDI output ports connecting and disconnecting.
+package liveevents
+
+import (
+	"fmt"
+	"log"
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	TypeControl = "control" // A control value, Data is ControlData
+	TypeMidi    = "midi"    // A MIDI message sent to the output ports, Data is MidiData
+	TypeModule  = "module"  // A module joined, left, moved or described itself, Data is moduleregistry.ModuleEvent
+	TypePort    = "port"    // A MIDI output port connected or disconnected, Data is midiOutputPipeline.PortStatus
+)
+
+// Event is one entry of the stream.
+type Event struct {
+	// <boot>-<n>, boot identifies the run of the backend and n counts up from 1 within it
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	ModuleID *uint8    `json:"module_id,omitempty"` // Not set for port events and MIDI not sent for a control
+	Data     any       `json:"data"`
+}
+
+// ControlData is a control reading as the transport received it, before the filters of
+// its mapping.
+type ControlData struct {
+	ControlID uint8   `json:"control_id"`
+	Value     float64 `json:"value"`
+	Delta     int     `json:"delta,omitempty"` // Movement of encoders
+	Raw       int     `json:"raw"`
+	Source    string  `json:"source"`
+}
+
+// MidiData is a MIDI message sent by the mapping engine, the MIDI tester or anything else.
+type MidiData struct {
+	ControlID *uint8                         `json:"control_id,omitempty"` // Only set for messages sent for a control
+	Kind      string                         `json:"kind"`
+	Ports     []string                       `json:"ports,omitempty"` // Only set for routed messages
+	Message   midiOutputPipeline.MidiMessage `json:"message"`
+}
+
+// Filter selects the events a subscriber receives. Empty lists select everything, events
+// without a module ID pass the module filter.
+type Filter struct {
+	Modules []uint8  `json:"modules,omitempty"`
+	Types   []string `json:"types,omitempty"`
+}
+
+// Match reports whether ev passes the filter.
+func (f Filter) Match(ev Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, ev.Type) {
+		return false
+	}
+	if len(f.Modules) > 0 && ev.ModuleID != nil && !slices.Contains(f.Modules, *ev.ModuleID) {
+		return false
+	}
+	return true
+}
+
+// Subscription receives the events passing its filter on Events until Close is called.
+// Slow subscribers miss events rather than holding up the others.
+type Subscription struct {
+	Events <-chan Event
+
+	ch     chan Event
+	mu     sync.Mutex
+	filter Filter
+}
+
+// historySize is how many of the latest events are kept for clients that reconnect.
+const historySize = 1024
+
+// boot tells the event IDs of this run of the backend from those of earlier runs.
+var boot = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+var (
+	mu          sync.Mutex
+	lastID      uint64 // n of the latest event
+	subscribers = make(map[*Subscription]struct{})
+	history     [historySize]Event // Ring buffer, event n is at (n-1) % historySize
+)
+
+// Subscribe starts receiving the events that pass filter.
+func Subscribe(filter Filter) *Subscription {
+	s := newSubscription(filter)
+
+	mu.Lock()
+	subscribers[s] = struct{}{}
+	mu.Unlock()
+	return s
+}
+
+// SubscribeAfter starts receiving the events that pass filter and also returns the kept
+// ones after the event with ID lastEventID, oldest first. complete is false if some of
+// them were already dropped from the history, or if lastEventID is from an earlier run
+// of the backend, in which case all kept events are returned.
+func SubscribeAfter(filter Filter, lastEventID string) (s *Subscription, replay []Event, complete bool, err error) {
+	eventBoot, n, ok := strings.Cut(lastEventID, "-")
+	afterID, err := strconv.ParseUint(n, 10, 64)
+	if !ok || eventBoot == "" || err != nil {
+		return nil, nil, false, fmt.Errorf("invalid event ID '%s'", lastEventID)
+	}
+	s = newSubscription(filter)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	first, complete := afterID+1, true
+	if eventBoot != boot || afterID > lastID {
+		first, complete = 1, false
+	}
+	if lastID > historySize && first <= lastID-historySize {
+		first, complete = lastID-historySize+1, false
+	}
+	for id := first; id <= lastID; id++ {
+		if ev := history[(id-1)%historySize]; filter.Match(ev) {
+			replay = append(replay, ev)
+		}
+	}
+	subscribers[s] = struct{}{}
+	return s, replay, complete, nil
+}
+
+func newSubscription(filter Filter) *Subscription {
+	s := &Subscription{ch: make(chan Event, 256), filter: filter}
+	s.Events = s.ch
+	return s
+}
+
+// SetFilter replaces the filter of a subscription.
+func (s *Subscription) SetFilter(filter Filter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filter = filter
+}
+
+// Close ends the subscription and closes Events.
+func (s *Subscription) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := subscribers[s]; ok {
+		delete(subscribers, s)
+		close(s.ch)
+	}
+}
+
+func (s *Subscription) match(ev Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter.Match(ev)
+}
+
+// Run collects the events of the backend until stopChan is closed. Start it once.
+func Run(stopChan <-chan struct{}) {
+	values, cancelValues := controlmapping.SubscribeInputs()
+	defer cancelValues()
+	messages, cancelMessages := midiOutputPipeline.SubscribeSent()
+	defer cancelMessages()
+	modules, cancelModules := moduleregistry.Subscribe()
+	defer cancelModules()
+	ports, cancelPorts := midiOutputPipeline.SubscribePorts()
+	defer cancelPorts()
+
+	log.Println("Live event stream started")
+	for {
+		select {
+		case <-stopChan:
+			return
+		case v := <-values:
+			publish(TypeControl, time.Now(), &v.ModuleID, ControlData{
+				ControlID: v.ControlID,
+				Value:     v.Value,
+				Delta:     v.Delta,
+				Raw:       v.Raw,
+				Source:    v.Source,
+			})
+		case m := <-messages:
+			data := MidiData{Kind: m.Message.Kind(), Ports: m.Ports, Message: m.Message}
+			var moduleID *uint8
+			if m.Source != nil {
+				moduleID, data.ControlID = &m.Source.ModuleID, &m.Source.ControlID
+			}
+			publish(TypeMidi, time.Now(), moduleID, data)
+		case ev := <-modules:
+			publish(TypeModule, ev.Time, &ev.Module.ID, ev)
+		case status := <-ports:
+			publish(TypePort, time.Now(), nil, status)
+		}
+	}
+}
+
+func publish(eventType string, t time.Time, moduleID *uint8, data any) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	lastID++
+	ev := Event{ID: fmt.Sprintf("%s-%d", boot, lastID), Type: eventType, Time: t, ModuleID: moduleID, Data: data}
+	history[(lastID-1)%historySize] = ev
+	for s := range subscribers {
+		if !s.match(ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+		}
+	}
+}
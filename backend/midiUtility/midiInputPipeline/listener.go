@@ -0,0 +1,168 @@
+// Package midiinputpipeline reads the MIDI input port selected in midi_ports.json, so
+// values the DAW sends back can be shown on the modules.
+package midiinputpipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	getvalues "modularMidiGoApp/backend/getValues"
+	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	midiports "modularMidiGoApp/backend/midiUtility/midiPorts"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+	"gitlab.com/gomidi/midi/v2/drivers/rtmididrv" // autoregisters driver
+)
+
+type selectedInPortStruct struct {
+	SelectedInPort midiports.PortID `json:"selected_midi_in_port"`
+}
+
+var (
+	rootPath = getvalues.FindRootPath()
+	filePath = filepath.Join(rootPath, "midiUtility", "midi_ports.json")
+)
+
+// MidiInChannel carries the messages received on the input port, using the same
+// message types as the output pipeline.
+var MidiInChannel = make(chan midiOutputPipeline.MidiMessage, 256)
+
+// virtualPortName is the name of the virtual input port, empty to use the selected port.
+var virtualPortName string
+
+// SetVirtualPortName makes MidiReader create its own input port with the given name
+// instead of using the port selected in midi_ports.json. Call it before starting MidiReader.
+func SetVirtualPortName(name string) {
+	virtualPortName = name
+}
+
+// MidiReader listens to the virtual or the selected input port until stopChan is closed.
+// Without either there is no feedback and it returns right away.
+func MidiReader(stopChan <-chan struct{}) {
+	if virtualPortName == "" {
+		if _, err := getSelectedInPort(); err != nil {
+			log.Printf("MIDI feedback disabled: %v", err)
+			return
+		}
+	}
+
+	for {
+		if err := listen(stopChan); err != nil {
+			log.Printf("MIDI input error: %v", err)
+			log.Println("Retrying in 5 seconds...")
+		}
+
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func listen(stopChan <-chan struct{}) error {
+	inPort, err := openInput()
+	if err != nil {
+		return err
+	}
+
+	stop, err := midi.ListenTo(inPort, func(msg midi.Message, timestampms int32) {
+		in, ok := translateIn(msg)
+		if !ok {
+			return
+		}
+		select {
+		case MidiInChannel <- in:
+		default:
+			log.Printf("Warning: MIDI input queue full, dropping %s message", in.Kind())
+		}
+	}, midi.HandleError(func(err error) {
+		log.Printf("Error reading MIDI input: %v", err)
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to open MIDI input port %s: %w", inPort, err)
+	}
+	defer stop()
+
+	log.Printf("Listening for MIDI feedback on %s", inPort)
+	<-stopChan
+	return nil
+}
+
+// openInput creates the virtual port if one is configured and falls back to the
+// port selected in midi_ports.json.
+func openInput() (drivers.In, error) {
+	if virtualPortName != "" {
+		in, err := openVirtualIn(virtualPortName)
+		if err == nil {
+			log.Printf("Created virtual MIDI input port %q", virtualPortName)
+			return in, nil
+		}
+		log.Printf("Failed to create virtual MIDI input port %q, using the selected port: %v", virtualPortName, err)
+	}
+
+	selected, err := getSelectedInPort()
+	if err != nil {
+		return nil, err
+	}
+	ins := midi.GetInPorts()
+	idx, kind, err := midiports.Match(selected, midiports.FromPorts(ins, midiports.DriverName()))
+	if err != nil {
+		return nil, fmt.Errorf("selected MIDI input port %s not found: %w", selected, err)
+	}
+	if kind == midiports.MatchFuzzy {
+		return nil, fmt.Errorf("selected MIDI input port %s not found, %s matches loosely, select it to use it", selected, ins[idx])
+	}
+	log.Printf("Using MIDI input port %s (%s match for %s)", ins[idx], kind, selected)
+	return ins[idx], nil
+}
+
+func openVirtualIn(name string) (drivers.In, error) {
+	drv, ok := drivers.Get().(*rtmididrv.Driver)
+	if !ok {
+		return nil, fmt.Errorf("virtual ports need the rtmidi driver")
+	}
+	return drv.OpenVirtualIn(name)
+}
+
+// translateIn converts the channel messages feedback can be mapped from.
+func translateIn(msg midi.Message) (midiOutputPipeline.MidiMessage, bool) {
+	var channel, data1, data2 uint8
+	var bend int16
+	var absolute uint16
+
+	switch {
+	case msg.GetControlChange(&channel, &data1, &data2):
+		return midiOutputPipeline.MidiCCMessage{Channel: channel, Controller: data1, Value: data2}, true
+	case msg.GetNoteStart(&channel, &data1, &data2):
+		return midiOutputPipeline.MidiNoteOnMessage{Channel: channel, Key: data1, Velocity: data2}, true
+	case msg.GetNoteEnd(&channel, &data1):
+		return midiOutputPipeline.MidiNoteOffMessage{Channel: channel, Key: data1}, true
+	case msg.GetPitchBend(&channel, &bend, &absolute):
+		return midiOutputPipeline.MidiPitchBendMessage{Channel: channel, Value: bend}, true
+	case msg.GetProgramChange(&channel, &data1):
+		return midiOutputPipeline.MidiProgramChangeMessage{Channel: channel, Program: data1}, true
+	case msg.GetAfterTouch(&channel, &data1):
+		return midiOutputPipeline.MidiAfterTouchMessage{Channel: channel, Pressure: data1}, true
+	}
+	return nil, false
+}
+
+func getSelectedInPort() (midiports.PortID, error) {
+	fileContent, err := os.ReadFile(filePath)
+	if err != nil {
+		return midiports.PortID{}, fmt.Errorf("failed to read MIDI file: %v", err)
+	}
+	var selected selectedInPortStruct
+	if err := json.Unmarshal(fileContent, &selected); err != nil {
+		return midiports.PortID{}, fmt.Errorf("failed to parse MIDI file JSON: %v", err)
+	}
+	if selected.SelectedInPort.Name == "" && selected.SelectedInPort.PortPath == "" {
+		return midiports.PortID{}, fmt.Errorf("no MIDI input port selected")
+	}
+	return selected.SelectedInPort, nil
+}
@@ -0,0 +1,284 @@
+package midioutputpipeline
+
+import (
+	"fmt"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// MidiMessage is anything that can be sent on MidiOutChannel.
+// MidiWriter translates every variant into the matching gomidi messages.
+type MidiMessage interface {
+	Kind() string
+}
+
+// MidiCCMessage is a 7-bit Control Change.
+type MidiCCMessage struct {
+	Channel    uint8
+	Controller uint8
+	Value      uint8
+}
+
+// MidiRelativeCCMessage is a Control Change carrying an encoder movement in one of the
+// relative encodings. Unlike MidiCCMessage it is never coalesced, every step counts.
+type MidiRelativeCCMessage struct {
+	Channel    uint8
+	Controller uint8
+	Value      uint8 // Already encoded
+}
+
+// MidiCC14Message is a 14-bit Control Change, sent as MSB on Controller (0-31)
+// followed by the LSB on Controller+32.
+type MidiCC14Message struct {
+	Channel    uint8
+	Controller uint8
+	Value      uint16 // 0-16383
+}
+
+// MidiNRPNMessage sets a Non-Registered Parameter Number to a 14-bit value.
+type MidiNRPNMessage struct {
+	Channel   uint8
+	Parameter uint16 // 0-16383
+	Value     uint16 // 0-16383
+}
+
+type MidiNoteOnMessage struct {
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+}
+
+type MidiNoteOffMessage struct {
+	Channel  uint8
+	Key      uint8
+	Velocity uint8
+}
+
+// MidiPitchBendMessage uses the signed range -8192 to 8191, 0 is the centre.
+type MidiPitchBendMessage struct {
+	Channel uint8
+	Value   int16
+}
+
+type MidiProgramChangeMessage struct {
+	Channel uint8
+	Program uint8
+}
+
+// MidiAfterTouchMessage is channel pressure.
+type MidiAfterTouchMessage struct {
+	Channel  uint8
+	Pressure uint8
+}
+
+type MidiPolyAfterTouchMessage struct {
+	Channel  uint8
+	Key      uint8
+	Pressure uint8
+}
+
+// MidiSysExMessage holds the bytes between 0xF0 and 0xF7, which are added when sending.
+type MidiSysExMessage struct {
+	Data []byte
+}
+
+// RoutedMessage sends Message only to the output ports named in Ports, by name or port
+// path. Other messages go to every open port.
+type RoutedMessage struct {
+	Ports   []string
+	Message MidiMessage
+}
+
+// MessageSource is the control of a module a message was sent for.
+type MessageSource struct {
+	ModuleID  uint8
+	ControlID uint8
+}
+
+// SourcedMessage is Message sent for a control, so SubscribeSent subscribers know where
+// it came from. MappingEngine marks all its messages this way.
+type SourcedMessage struct {
+	Source  MessageSource
+	Message MidiMessage
+}
+
+// DiscreteMessage sends Message with every value counting, e.g. the press and release
+// of a button sent as CC. Unlike Message on its own it is never coalesced or rate limited.
+type DiscreteMessage struct {
+	Message MidiMessage
+}
+
+func (m RoutedMessage) Kind() string           { return m.Message.Kind() }
+func (m DiscreteMessage) Kind() string         { return m.Message.Kind() }
+func (m SourcedMessage) Kind() string          { return m.Message.Kind() }
+func (MidiCCMessage) Kind() string             { return "control_change" }
+func (MidiRelativeCCMessage) Kind() string     { return "relative_control_change" }
+func (MidiCC14Message) Kind() string           { return "control_change_14bit" }
+func (MidiNRPNMessage) Kind() string           { return "nrpn" }
+func (MidiNoteOnMessage) Kind() string         { return "note_on" }
+func (MidiNoteOffMessage) Kind() string        { return "note_off" }
+func (MidiPitchBendMessage) Kind() string      { return "pitch_bend" }
+func (MidiProgramChangeMessage) Kind() string  { return "program_change" }
+func (MidiAfterTouchMessage) Kind() string     { return "aftertouch" }
+func (MidiPolyAfterTouchMessage) Kind() string { return "poly_aftertouch" }
+func (MidiSysExMessage) Kind() string          { return "sysex" }
+
+// translate converts a MidiMessage into the raw messages that have to be sent, in order.
+func translate(msg MidiMessage) ([]midi.Message, error) {
+	switch m := msg.(type) {
+	case RoutedMessage:
+		return translate(m.Message)
+	case DiscreteMessage:
+		return translate(m.Message)
+	case SourcedMessage:
+		return translate(m.Message)
+
+	case MidiCCMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Controller > 127 || m.Value > 127 {
+			return nil, fmt.Errorf("CC %d with value %d out of range", m.Controller, m.Value)
+		}
+		return []midi.Message{midi.ControlChange(m.Channel, m.Controller, m.Value)}, nil
+
+	case MidiRelativeCCMessage:
+		return translate(MidiCCMessage(m))
+
+	case MidiCC14Message:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Controller > 31 {
+			return nil, fmt.Errorf("14-bit CC needs a controller between 0 and 31, got %d", m.Controller)
+		}
+		if m.Value > 16383 {
+			return nil, fmt.Errorf("14-bit CC value %d out of range", m.Value)
+		}
+		msb, lsb := splitValue14(m.Value)
+		return []midi.Message{
+			midi.ControlChange(m.Channel, m.Controller, msb),
+			midi.ControlChange(m.Channel, m.Controller+32, lsb),
+		}, nil
+
+	case MidiNRPNMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Parameter > 16383 || m.Value > 16383 {
+			return nil, fmt.Errorf("NRPN %d with value %d out of range", m.Parameter, m.Value)
+		}
+		paramMSB, paramLSB := splitValue14(m.Parameter)
+		valueMSB, valueLSB := splitValue14(m.Value)
+		return []midi.Message{
+			midi.ControlChange(m.Channel, 99, paramMSB),
+			midi.ControlChange(m.Channel, 98, paramLSB),
+			midi.ControlChange(m.Channel, 6, valueMSB),
+			midi.ControlChange(m.Channel, 38, valueLSB),
+		}, nil
+
+	case MidiNoteOnMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Key > 127 || m.Velocity > 127 {
+			return nil, fmt.Errorf("note %d with velocity %d out of range", m.Key, m.Velocity)
+		}
+		return []midi.Message{midi.NoteOn(m.Channel, m.Key, m.Velocity)}, nil
+
+	case MidiNoteOffMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Key > 127 || m.Velocity > 127 {
+			return nil, fmt.Errorf("note %d with velocity %d out of range", m.Key, m.Velocity)
+		}
+		return []midi.Message{midi.NoteOffVelocity(m.Channel, m.Key, m.Velocity)}, nil
+
+	case MidiPitchBendMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Value < midi.PitchLowest || m.Value > midi.PitchHighest {
+			return nil, fmt.Errorf("pitch bend value %d out of range", m.Value)
+		}
+		return []midi.Message{midi.Pitchbend(m.Channel, m.Value)}, nil
+
+	case MidiProgramChangeMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Program > 127 {
+			return nil, fmt.Errorf("program %d out of range", m.Program)
+		}
+		return []midi.Message{midi.ProgramChange(m.Channel, m.Program)}, nil
+
+	case MidiAfterTouchMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Pressure > 127 {
+			return nil, fmt.Errorf("aftertouch pressure %d out of range", m.Pressure)
+		}
+		return []midi.Message{midi.AfterTouch(m.Channel, m.Pressure)}, nil
+
+	case MidiPolyAfterTouchMessage:
+		if err := checkChannel(m.Channel); err != nil {
+			return nil, err
+		}
+		if m.Key > 127 || m.Pressure > 127 {
+			return nil, fmt.Errorf("poly aftertouch key %d with pressure %d out of range", m.Key, m.Pressure)
+		}
+		return []midi.Message{midi.PolyAfterTouch(m.Channel, m.Key, m.Pressure)}, nil
+
+	case MidiSysExMessage:
+		for _, b := range m.Data {
+			if b > 127 {
+				return nil, fmt.Errorf("SysEx data byte 0x%02X out of range", b)
+			}
+		}
+		return []midi.Message{midi.SysEx(m.Data)}, nil
+	}
+	return nil, fmt.Errorf("unsupported MIDI message type %T", msg)
+}
+
+// wrapping is what the wrapper messages around a message say about it.
+type wrapping struct {
+	ports    []string // Set by RoutedMessage
+	discrete bool
+	source   *MessageSource
+}
+
+// unwrap returns the message inside any RoutedMessage, DiscreteMessage and
+// SourcedMessage around msg, in whatever order they were nested.
+func unwrap(msg MidiMessage) (MidiMessage, wrapping) {
+	var w wrapping
+	for {
+		switch m := msg.(type) {
+		case RoutedMessage:
+			w.ports = m.Ports
+			msg = m.Message
+		case DiscreteMessage:
+			w.discrete = true
+			msg = m.Message
+		case SourcedMessage:
+			source := m.Source
+			w.source = &source
+			msg = m.Message
+		default:
+			return msg, w
+		}
+	}
+}
+
+func checkChannel(channel uint8) error {
+	if channel > 15 {
+		return fmt.Errorf("MIDI channel %d out of range (0-15)", channel)
+	}
+	return nil
+}
+
+// splitValue14 splits a 14-bit value into its 7-bit MSB and LSB.
+func splitValue14(value uint16) (msb uint8, lsb uint8) {
+	return uint8(value>>7) & 0x7F, uint8(value) & 0x7F
+}
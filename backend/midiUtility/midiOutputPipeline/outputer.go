@@ -4,30 +4,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"modularMidiGoApp/backend/fanout"
 	getvalues "modularMidiGoApp/backend/getValues"
+	midiports "modularMidiGoApp/backend/midiUtility/midiPorts"
 	"os"
 	"path/filepath"
-	"regexp"
-	"unicode/utf8"
+	"time"
 
 	"gitlab.com/gomidi/midi/v2"
-	_ "gitlab.com/gomidi/midi/v2/drivers/rtmididrv" // autoregisters driver
+	"gitlab.com/gomidi/midi/v2/drivers"
+	"gitlab.com/gomidi/midi/v2/drivers/rtmididrv" // autoregisters driver
 )
 
 type SelectedPortStruct struct {
-	SelectedPort SelectedPortData `json:"selected_midi_port"`
-}
-
-type SelectedPortData struct {
-	Name     string `json:"name"`
-	PortPath string `json:"port_path"`
-}
-
-// Place this struct definition where both WiggleTest and MidiWriter can see it.
-type MidiCCMessage struct {
-	Channel    uint8
-	Controller uint8
-	Value      uint8
+	SelectedPort  midiports.PortID   `json:"selected_midi_port"`
+	SelectedPorts []midiports.PortID `json:"selected_midi_ports"` // All used at once, see wantedPorts
 }
 
 var (
@@ -35,110 +26,110 @@ var (
 	dirPath_MO  = filepath.Join(rootPath_MO, "midiUtility")
 )
 
-var MidiOutChannel = make(chan MidiCCMessage)
+// MidiOutChannel takes the messages for MidiWriter. It is drained right away into the
+// output queue, so senders only wait with the block queue policy.
+var MidiOutChannel = make(chan MidiMessage)
 
-func MidiWriter() {
-	// Get available MIDI outputs
-	defer midi.CloseDriver()
-
-	outs := midi.GetOutPorts()
-	if len(outs) == 0 {
-		fmt.Println("No MIDI output ports available")
-		return
-	}
+// virtualPortName is the name of the virtual output port, empty to use the selected port.
+var virtualPortName string
 
-	// Set the selected port
-	portIdx, err := getSelectedPort()
-	if err != nil {
-		fmt.Printf("Error getting selected port: %v\n", err)
-		return
-	}
-	outPortID := outs[portIdx]
-	send, err := midi.SendTo(outPortID)
-	if err != nil {
-		fmt.Printf("Error opening MIDI output port %s: %v\n", outPortID)
-	}
-
-	outChannel := MidiOutChannel
-
-	for msg := range outChannel {
-		fmt.Printf("Received MIDI message: %v\n", msg)
+// SetVirtualPortName makes MidiWriter create its own output port with the given name
+// instead of using the port selected in midi_ports.json. Call it before starting MidiWriter.
+func SetVirtualPortName(name string) {
+	virtualPortName = name
+}
 
-		err := send(midi.ControlChange(msg.Channel, msg.Controller, msg.Value))
-		if err != nil {
-			log.Printf("Error sending CC %d with value %d: %v", msg.Controller, msg.Value, err)
-		}
+// MidiWriter drains MidiOutChannel for as long as the driver runs. Messages wait in a
+// bounded queue (see queue.go) and ports that are missing or get unplugged are reopened
+// by the supervisor (see supervisor.go).
+func MidiWriter() {
+	defer midi.CloseDriver()
 
-		/*
-			for i, value := range msg {
-				err := send(midi.ControlChange(0, uint8(i), value))
-				if err != nil {
-					log.Printf("Error sending CC %d with value %d: %v", i, value, err)
-					continue
+	go pumpOutChannel()
+
+	supervisor.limiter = newRateLimiter(writerConfig.MaxRate)
+	supervisor.rescan()
+	ticker := time.NewTicker(writerConfig.RescanInterval)
+	defer ticker.Stop()
+
+	// Fires when the rate limit has held back an update that is due now
+	flush := time.NewTimer(time.Hour)
+	flush.Stop()
+
+	warned := make(map[string]bool) // Unknown port names of routed messages, warned once
+
+	for {
+		select {
+		case <-ticker.C:
+			supervisor.rescan()
+		case <-flush.C:
+		case <-queue.ready:
+			for {
+				msg, ok := queue.pop()
+				if !ok {
+					break
 				}
+				writeMessage(msg, warned)
 			}
-		*/
-	}
-}
+			if queue.isClosed() {
+				return
+			}
+		}
 
-func getPortPathFromOuts(inputStr string) string {
-	// Ensure we handle strings shorter than 5 characters gracefully.
-	if utf8.RuneCountInString(inputStr) < 5 {
-		// If the string is shorter than 5 runes, process the whole string.
-		re := regexp.MustCompile(`\s+`)
-		return re.ReplaceAllString(inputStr, "")
+		if wait, ok := supervisor.flushDue(); ok {
+			flush.Reset(wait)
+		}
 	}
+}
 
-	// Get the last 5 runes (characters) from the string.
-	// This is important for UTF-8 safety.
-	runes := []rune(inputStr)
-	lastFiveRunes := runes[len(runes)-5:]
-	lastFiveStr := string(lastFiveRunes)
-
-	// Compile a regular expression to find all whitespace characters.
-	// \s matches space, tab, newline, and other unicode spaces.
-	// + matches one or more occurrences.
-	re := regexp.MustCompile(`\s+`)
+// SentMessage is a message MidiWriter passed on to the output ports. The rate limit may
+// still replace it with a later value of the same controller.
+type SentMessage struct {
+	Message MidiMessage    // Without the wrapper messages around it
+	Ports   []string       // Only set for routed messages
+	Source  *MessageSource // Only set for messages sent for a control
+}
 
-	// Replace all found whitespace with an empty string.
-	outputStr := re.ReplaceAllString(lastFiveStr, "")
+var sentEvents fanout.Fanout[SentMessage]
 
-	return outputStr
+// SubscribeSent returns a channel receiving every message MidiWriter sends, whoever
+// sent it. Slow subscribers miss messages rather than holding up the ports. Call cancel
+// when done.
+func SubscribeSent() (messages <-chan SentMessage, cancel func()) {
+	return sentEvents.Subscribe(256)
 }
 
-func getSelectedPort() (int, error) {
-	outs := midi.GetOutPorts()
-	if len(outs) == 0 {
-		return 0, fmt.Errorf("no MIDI output ports available")
-	}
-	portPath, err := getMIDIFileContent()
+func writeMessage(msg MidiMessage, warned map[string]bool) {
+	inner, w := unwrap(msg)
+	raw, err := translate(inner)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get MIDI file content: %v", err)
-	}
-	for i, out := range outs {
-		fmt.Printf("Checking port %d: %s\n", i+1, out.String()) // Debug output
-		fmt.Printf("Expected port path: %s\n", portPath)        // Debug output
-		if getPortPathFromOuts(out.String()) == portPath {
-			fmt.Printf("Selected port found: %s\n", out.String()) // Debug output
-			return i, nil
-		}
+		log.Printf("Error translating %s message: %v", inner.Kind(), err)
+		return
 	}
-	return 0, fmt.Errorf("selected MIDI port not found: %s", portPath)
+	key, _ := coalesceKey(msg)
+	supervisor.deliver(w.ports, key, raw, warned)
+	sentEvents.Publish(SentMessage{Message: inner, Ports: w.ports, Source: w.source})
+}
 
+func openVirtualOut(name string) (drivers.Out, error) {
+	drv, ok := drivers.Get().(*rtmididrv.Driver)
+	if !ok {
+		return nil, fmt.Errorf("virtual ports need the rtmidi driver")
+	}
+	return drv.OpenVirtualOut(name)
 }
 
-func getMIDIFileContent() (string, error) {
+func getMIDIFileContent() (SelectedPortStruct, error) {
 	midi_filePath := filepath.Join(dirPath_MO, "midi_ports.json")
 
 	fileContent, err := os.ReadFile(midi_filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read MIDI file: %v", err)
+		return SelectedPortStruct{}, fmt.Errorf("failed to read MIDI file: %v", err)
 	}
 	var selectedPort SelectedPortStruct
 	if err := json.Unmarshal(fileContent, &selectedPort); err != nil {
-		return "", fmt.Errorf("failed to parse MIDI file JSON: %v", err)
+		return SelectedPortStruct{}, fmt.Errorf("failed to parse MIDI file JSON: %v", err)
 	}
 
-	// Return the port_path instead of the whole object
-	return selectedPort.SelectedPort.PortPath, nil
+	return selectedPort, nil
 }
@@ -0,0 +1,230 @@
+package midioutputpipeline
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueuePolicy decides what happens when a message arrives while the queue is full.
+type QueuePolicy string
+
+const (
+	QueueDropOldest QueuePolicy = "drop_oldest" // The oldest queued message is dropped
+	QueueDropNewest QueuePolicy = "drop_newest" // The arriving message is dropped
+	// QueueCoalesce replaces a queued value of the same controller instead of queueing
+	// another one, and drops the oldest message when still full.
+	QueueCoalesce QueuePolicy = "coalesce"
+	QueueBlock    QueuePolicy = "block" // The sender waits up to BlockTimeout, then the message is dropped
+)
+
+// QueueConfig configures the queue between MidiOutChannel and the ports.
+type QueueConfig struct {
+	Size         int
+	Policy       QueuePolicy
+	BlockTimeout time.Duration
+}
+
+var DefaultQueueConfig = QueueConfig{
+	Size:         1024,
+	Policy:       QueueCoalesce,
+	BlockTimeout: 50 * time.Millisecond,
+}
+
+// ParseQueuePolicy parses the queue_policy config value.
+func ParseQueuePolicy(s string) (QueuePolicy, error) {
+	switch p := QueuePolicy(s); p {
+	case QueueDropOldest, QueueDropNewest, QueueCoalesce, QueueBlock:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy '%s' (drop_oldest, drop_newest, coalesce, block)", s)
+}
+
+// QueueStats are the counters of the output queue, reported by the HTTP API.
+type QueueStats struct {
+	Policy    QueuePolicy `json:"policy"`
+	Capacity  int         `json:"capacity"`
+	Depth     int         `json:"depth"`
+	HighWater int         `json:"high_water"` // Largest depth so far
+	Enqueued  uint64      `json:"enqueued"`
+	Coalesced uint64      `json:"coalesced"`
+	Dropped   uint64      `json:"dropped"`
+	Timeouts  uint64      `json:"timeouts"` // Messages dropped after waiting with QueueBlock
+	Sent      uint64      `json:"sent"`     // Messages handed to the ports
+}
+
+type outputQueue struct {
+	mu     sync.Mutex
+	conf   QueueConfig
+	items  []MidiMessage
+	ready  chan struct{} // Signalled when items were added
+	space  chan struct{} // Signalled when items were removed, for QueueBlock
+	stats  QueueStats
+	closed bool
+}
+
+var queue = newOutputQueue(DefaultQueueConfig)
+
+func newOutputQueue(conf QueueConfig) *outputQueue {
+	if conf.Size < 1 {
+		conf.Size = 1
+	}
+	return &outputQueue{
+		conf:  conf,
+		ready: make(chan struct{}, 1),
+		space: make(chan struct{}, 1),
+		stats: QueueStats{Policy: conf.Policy, Capacity: conf.Size},
+	}
+}
+
+// SetQueueConfig replaces DefaultQueueConfig. Call it before starting MidiWriter.
+func SetQueueConfig(c QueueConfig) {
+	queue = newOutputQueue(c)
+}
+
+// OutputQueueStats returns the counters of the output queue.
+func OutputQueueStats() QueueStats {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	stats := queue.stats
+	stats.Depth = len(queue.items)
+	return stats
+}
+
+// pumpOutChannel moves everything sent on MidiOutChannel into the queue, so senders
+// only wait for MidiWriter with QueueBlock.
+func pumpOutChannel() {
+	for msg := range MidiOutChannel {
+		queue.push(msg)
+	}
+	queue.close()
+}
+
+func (q *outputQueue) push(msg MidiMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.conf.Policy == QueueCoalesce {
+		if key, ok := coalesceKey(msg); ok {
+			for i, queued := range q.items {
+				if queuedKey, ok := coalesceKey(queued); ok && queuedKey == key {
+					q.items[i] = msg
+					q.stats.Coalesced++
+					return
+				}
+			}
+		}
+	}
+
+	if len(q.items) >= q.conf.Size {
+		switch q.conf.Policy {
+		case QueueDropNewest:
+			q.stats.Dropped++
+			return
+		case QueueBlock:
+			if !q.waitForSpace() {
+				q.stats.Dropped++
+				q.stats.Timeouts++
+				return
+			}
+		default:
+			q.items = q.items[1:]
+			q.stats.Dropped++
+		}
+	}
+
+	q.items = append(q.items, msg)
+	q.stats.Enqueued++
+	if len(q.items) > q.stats.HighWater {
+		q.stats.HighWater = len(q.items)
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// waitForSpace must be called with mu held. It reports whether there is room now.
+func (q *outputQueue) waitForSpace() bool {
+	deadline := time.NewTimer(q.conf.BlockTimeout)
+	defer deadline.Stop()
+
+	for len(q.items) >= q.conf.Size {
+		q.mu.Unlock()
+		select {
+		case <-q.space:
+			q.mu.Lock()
+		case <-deadline.C:
+			q.mu.Lock()
+			return len(q.items) < q.conf.Size
+		}
+	}
+	return true
+}
+
+// pop returns the oldest message, ok is false when the queue is empty.
+func (q *outputQueue) pop() (MidiMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return nil, false
+	}
+	msg := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.stats.Sent++
+	select {
+	case q.space <- struct{}{}:
+	default:
+	}
+	return msg, true
+}
+
+func (q *outputQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// isClosed reports whether MidiOutChannel was closed and everything was sent.
+func (q *outputQueue) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed && len(q.items) == 0
+}
+
+// coalesceKey identifies messages where only the latest value matters: continuous
+// controllers, pitch bend and pressure. Notes, program changes, SysEx and discrete
+// messages are never merged. Routed messages only merge with messages for the same ports.
+func coalesceKey(msg MidiMessage) (string, bool) {
+	msg, w := unwrap(msg)
+	if w.discrete {
+		return "", false
+	}
+	ports := strings.Join(w.ports, "\x00")
+
+	var key string
+	switch m := msg.(type) {
+	case MidiCCMessage:
+		key = fmt.Sprintf("cc/%d/%d", m.Channel, m.Controller)
+	case MidiCC14Message:
+		key = fmt.Sprintf("cc14/%d/%d", m.Channel, m.Controller)
+	case MidiNRPNMessage:
+		key = fmt.Sprintf("nrpn/%d/%d", m.Channel, m.Parameter)
+	case MidiPitchBendMessage:
+		key = fmt.Sprintf("pb/%d", m.Channel)
+	case MidiAfterTouchMessage:
+		key = fmt.Sprintf("at/%d", m.Channel)
+	case MidiPolyAfterTouchMessage:
+		key = fmt.Sprintf("pat/%d/%d", m.Channel, m.Key)
+	default:
+		return "", false
+	}
+	return ports + "|" + key, true
+}
@@ -0,0 +1,151 @@
+package midioutputpipeline
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func cc(controller, value uint8) MidiCCMessage {
+	return MidiCCMessage{Channel: 0, Controller: controller, Value: value}
+}
+
+func drain(q *outputQueue) []MidiMessage {
+	var got []MidiMessage
+	for {
+		msg, ok := q.pop()
+		if !ok {
+			return got
+		}
+		got = append(got, msg)
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	note := MidiNoteOnMessage{Channel: 0, Key: 60, Velocity: 100}
+
+	tests := []struct {
+		name      string
+		policy    QueuePolicy
+		size      int
+		push      []MidiMessage
+		want      []MidiMessage
+		dropped   uint64
+		coalesced uint64
+	}{
+		{
+			name:    "drop oldest",
+			policy:  QueueDropOldest,
+			size:    2,
+			push:    []MidiMessage{cc(1, 1), cc(2, 2), cc(3, 3)},
+			want:    []MidiMessage{cc(2, 2), cc(3, 3)},
+			dropped: 1,
+		},
+		{
+			name:    "drop newest",
+			policy:  QueueDropNewest,
+			size:    2,
+			push:    []MidiMessage{cc(1, 1), cc(2, 2), cc(3, 3)},
+			want:    []MidiMessage{cc(1, 1), cc(2, 2)},
+			dropped: 1,
+		},
+		{
+			name:      "coalesce replaces the queued value in place",
+			policy:    QueueCoalesce,
+			size:      4,
+			push:      []MidiMessage{cc(1, 1), note, cc(1, 2), cc(1, 3)},
+			want:      []MidiMessage{cc(1, 3), note},
+			coalesced: 2,
+		},
+		{
+			name:    "coalesce drops the oldest when nothing merges",
+			policy:  QueueCoalesce,
+			size:    2,
+			push:    []MidiMessage{note, cc(1, 1), cc(2, 2)},
+			want:    []MidiMessage{cc(1, 1), cc(2, 2)},
+			dropped: 1,
+		},
+		{
+			name:   "coalesce keeps every discrete value",
+			policy: QueueCoalesce,
+			size:   4,
+			push:   []MidiMessage{DiscreteMessage{cc(1, 127)}, DiscreteMessage{cc(1, 0)}},
+			want:   []MidiMessage{DiscreteMessage{cc(1, 127)}, DiscreteMessage{cc(1, 0)}},
+		},
+		{
+			name:   "coalesce finds discrete messages inside other wrappers",
+			policy: QueueCoalesce,
+			size:   4,
+			push: []MidiMessage{
+				RoutedMessage{Ports: []string{"a"}, Message: SourcedMessage{Message: DiscreteMessage{cc(1, 127)}}},
+				RoutedMessage{Ports: []string{"a"}, Message: SourcedMessage{Message: DiscreteMessage{cc(1, 0)}}},
+				SourcedMessage{Message: cc(2, 1)},
+				SourcedMessage{Source: MessageSource{ModuleID: 1}, Message: cc(2, 2)},
+			},
+			want: []MidiMessage{
+				RoutedMessage{Ports: []string{"a"}, Message: SourcedMessage{Message: DiscreteMessage{cc(1, 127)}}},
+				RoutedMessage{Ports: []string{"a"}, Message: SourcedMessage{Message: DiscreteMessage{cc(1, 0)}}},
+				SourcedMessage{Source: MessageSource{ModuleID: 1}, Message: cc(2, 2)},
+			},
+			coalesced: 1,
+		},
+		{
+			name:   "coalesce keeps routes apart",
+			policy: QueueCoalesce,
+			size:   4,
+			push: []MidiMessage{
+				RoutedMessage{Ports: []string{"a"}, Message: cc(1, 1)},
+				RoutedMessage{Ports: []string{"b"}, Message: cc(1, 2)},
+			},
+			want: []MidiMessage{
+				RoutedMessage{Ports: []string{"a"}, Message: cc(1, 1)},
+				RoutedMessage{Ports: []string{"b"}, Message: cc(1, 2)},
+			},
+		},
+		{
+			name:    "block gives up after the timeout",
+			policy:  QueueBlock,
+			size:    1,
+			push:    []MidiMessage{cc(1, 1), cc(2, 2)},
+			want:    []MidiMessage{cc(1, 1)},
+			dropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newOutputQueue(QueueConfig{Size: tt.size, Policy: tt.policy, BlockTimeout: time.Millisecond})
+			for _, msg := range tt.push {
+				q.push(msg)
+			}
+			stats := q.stats
+			if got := drain(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queue holds %v, want %v", got, tt.want)
+			}
+			if stats.Dropped != tt.dropped || stats.Coalesced != tt.coalesced {
+				t.Errorf("dropped %d, coalesced %d, want %d and %d", stats.Dropped, stats.Coalesced, tt.dropped, tt.coalesced)
+			}
+			if stats.HighWater > tt.size {
+				t.Errorf("high water %d above the size %d", stats.HighWater, tt.size)
+			}
+		})
+	}
+}
+
+func TestQueueBlockWaitsForSpace(t *testing.T) {
+	q := newOutputQueue(QueueConfig{Size: 1, Policy: QueueBlock, BlockTimeout: 5 * time.Second})
+	q.push(cc(1, 1))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.pop()
+	}()
+	q.push(cc(2, 2))
+
+	if got := drain(q); !reflect.DeepEqual(got, []MidiMessage{cc(2, 2)}) {
+		t.Errorf("queue holds %v, want the second message", got)
+	}
+	if q.stats.Dropped != 0 || q.stats.Timeouts != 0 {
+		t.Errorf("dropped %d with %d timeouts, want none", q.stats.Dropped, q.stats.Timeouts)
+	}
+}
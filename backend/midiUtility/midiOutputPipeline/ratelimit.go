@@ -0,0 +1,94 @@
+package midioutputpipeline
+
+import (
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// rateLimiter limits how often a controller is updated on a port. Updates coming in
+// faster are held back and only the latest one is sent once the interval has passed,
+// so a fader always ends up at its final value.
+type rateLimiter struct {
+	interval time.Duration
+	last     map[limitKey]time.Time
+	pending  map[limitKey][]midi.Message
+}
+
+// limitKey is a port and a controller as built by coalesceKey, e.g. channel and CC number.
+type limitKey struct {
+	port *managedPort
+	key  string
+}
+
+func newRateLimiter(maxRate float64) *rateLimiter {
+	if maxRate <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / maxRate),
+		last:     make(map[limitKey]time.Time),
+		pending:  make(map[limitKey][]midi.Message),
+	}
+}
+
+// admit reports whether raw may be sent to p now. Otherwise it replaces the update
+// held back for the same controller.
+func (l *rateLimiter) admit(p *managedPort, key string, raw []midi.Message, now time.Time) bool {
+	k := limitKey{p, key}
+	if last, ok := l.last[k]; ok && now.Sub(last) < l.interval {
+		l.pending[k] = raw
+		return false
+	}
+	l.last[k] = now
+	delete(l.pending, k)
+	return true
+}
+
+// due removes and returns the held back updates whose interval has passed.
+func (l *rateLimiter) due(now time.Time, send func(p *managedPort, raw []midi.Message)) {
+	for k, raw := range l.pending {
+		if now.Sub(l.last[k]) >= l.interval {
+			delete(l.pending, k)
+			l.last[k] = now
+			send(k.port, raw)
+		}
+	}
+	// Forget controllers that have been idle, so the maps don't grow forever
+	for k, last := range l.last {
+		if _, held := l.pending[k]; !held && now.Sub(last) > time.Minute {
+			delete(l.last, k)
+		}
+	}
+}
+
+// next returns how long until the next held back update is due.
+func (l *rateLimiter) next(now time.Time) (time.Duration, bool) {
+	var wait time.Duration
+	found := false
+	for k := range l.pending {
+		d := l.interval - now.Sub(l.last[k])
+		if !found || d < wait {
+			wait = d
+			found = true
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, found
+}
+
+// forget drops everything held back for a port that is no longer used.
+func (l *rateLimiter) forget(p *managedPort) {
+	for k := range l.pending {
+		if k.port == p {
+			delete(l.pending, k)
+		}
+	}
+	for k := range l.last {
+		if k.port == p {
+			delete(l.last, k)
+		}
+	}
+}
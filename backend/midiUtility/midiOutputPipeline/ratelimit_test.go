@@ -0,0 +1,84 @@
+package midioutputpipeline
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// sentValues collects the CC values a rate limiter lets through, per port.
+type sentValues map[*managedPort][]uint8
+
+func (s sentValues) send(p *managedPort, raw []midi.Message) {
+	var channel, controller, value uint8
+	raw[0].GetControlChange(&channel, &controller, &value)
+	s[p] = append(s[p], value)
+}
+
+func TestRateLimiterSendsFinalValue(t *testing.T) {
+	l := newRateLimiter(100) // One update per 10ms
+	port := &managedPort{}
+	sent := make(sentValues)
+	start := time.Now()
+
+	// A fader moved from 0 to 127 within 128ms, updating every millisecond
+	var now time.Time
+	for v := 0; v <= 127; v++ {
+		now = start.Add(time.Duration(v) * time.Millisecond)
+		l.due(now, sent.send)
+		raw := []midi.Message{midi.ControlChange(0, 7, uint8(v))}
+		if l.admit(port, "cc/0/7", raw, now) {
+			sent.send(port, raw)
+		}
+	}
+
+	wait, pending := l.next(now)
+	if !pending || wait > l.interval {
+		t.Fatalf("next = %v, %t, want the final value due within %v", wait, pending, l.interval)
+	}
+	l.due(now.Add(wait), sent.send)
+
+	values := sent[port]
+	if len(values) == 0 || values[len(values)-1] != 127 {
+		t.Fatalf("sent %v, want it to end with the final value 127", values)
+	}
+	// 128ms at 100 per second: the first value, one every 10ms and the final one
+	if len(values) > 15 {
+		t.Errorf("sent %d updates in 128ms, want at most 15", len(values))
+	}
+	if _, pending := l.next(now.Add(wait)); pending {
+		t.Error("updates still held back after the final value was sent")
+	}
+}
+
+func TestRateLimiterKeepsControllersApart(t *testing.T) {
+	l := newRateLimiter(10)
+	a, b := &managedPort{}, &managedPort{}
+	now := time.Now()
+	raw := []midi.Message{midi.ControlChange(0, 1, 1)}
+
+	if !l.admit(a, "cc/0/1", raw, now) {
+		t.Fatal("first update was held back")
+	}
+	if !l.admit(a, "cc/0/2", raw, now) {
+		t.Error("another controller was held back")
+	}
+	if !l.admit(b, "cc/0/1", raw, now) {
+		t.Error("the same controller on another port was held back")
+	}
+	if l.admit(a, "cc/0/1", raw, now.Add(time.Millisecond)) {
+		t.Error("a second update within the interval was let through")
+	}
+
+	l.forget(a)
+	if _, pending := l.next(now); pending {
+		t.Error("updates of a forgotten port are still held back")
+	}
+}
+
+func TestRateLimiterOff(t *testing.T) {
+	if l := newRateLimiter(0); l != nil {
+		t.Errorf("newRateLimiter(0) = %+v, want nil", l)
+	}
+}
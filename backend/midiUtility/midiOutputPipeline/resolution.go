@@ -0,0 +1,71 @@
+package midioutputpipeline
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// OutputMode selects how a continuous control value is sent.
+type OutputMode string
+
+const (
+	ModeCC        OutputMode = "cc"        // 7-bit Control Change
+	ModeCC14      OutputMode = "cc14"      // 14-bit Control Change, MSB on n and LSB on n+32
+	ModeNRPN      OutputMode = "nrpn"      // 14-bit NRPN, the control number is the parameter
+	ModePitchBend OutputMode = "pitchbend" // 14-bit Pitch Bend, the control number is ignored
+)
+
+// ParseOutputMode accepts the mode names used in modularMidi.conf.
+func ParseOutputMode(name string) (OutputMode, error) {
+	switch mode := OutputMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case ModeCC, ModeCC14, ModeNRPN, ModePitchBend:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown output mode '%s'", name)
+}
+
+// BuildControlMessage creates the message for a normalized value between 0 and 1.
+func BuildControlMessage(mode OutputMode, channel uint8, number uint16, normalized float64) (MidiMessage, error) {
+	value14 := Scale14(normalized)
+
+	switch mode {
+	case ModeCC:
+		if number > 127 {
+			return nil, fmt.Errorf("CC number %d out of range", number)
+		}
+		return MidiCCMessage{Channel: channel, Controller: uint8(number), Value: Scale7(normalized)}, nil
+	case ModeCC14:
+		if number > 31 {
+			return nil, fmt.Errorf("14-bit CC needs a controller between 0 and 31, got %d", number)
+		}
+		return MidiCC14Message{Channel: channel, Controller: uint8(number), Value: value14}, nil
+	case ModeNRPN:
+		return MidiNRPNMessage{Channel: channel, Parameter: number, Value: value14}, nil
+	case ModePitchBend:
+		return MidiPitchBendMessage{Channel: channel, Value: int16(value14) - 8192}, nil
+	}
+	return nil, fmt.Errorf("unknown output mode '%s'", mode)
+}
+
+// Scale7 maps a normalized value onto 0-127.
+func Scale7(normalized float64) uint8 {
+	return uint8(math.Round(Clamp01(normalized) * 127))
+}
+
+// Scale14 maps a normalized value onto 0-16383.
+func Scale14(normalized float64) uint16 {
+	return uint16(math.Round(Clamp01(normalized) * 16383))
+}
+
+// Clamp01 limits a normalized value to 0-1. NaN, e.g. from a division by a zero range,
+// becomes 0 so it never turns into an arbitrary MIDI value.
+func Clamp01(v float64) float64 {
+	if v < 0 || math.IsNaN(v) {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,368 @@
+package midioutputpipeline
+
+import (
+	"fmt"
+	"log"
+	"modularMidiGoApp/backend/fanout"
+	midiports "modularMidiGoApp/backend/midiUtility/midiPorts"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// DisconnectPolicy decides what happens to messages for a port that is not connected.
+type DisconnectPolicy string
+
+const (
+	PolicyDrop   DisconnectPolicy = "drop"   // Messages are counted and dropped
+	PolicyBuffer DisconnectPolicy = "buffer" // Messages are sent once the port is back, oldest dropped when full
+)
+
+// WriterConfig configures how MidiWriter watches its ports.
+type WriterConfig struct {
+	RescanInterval time.Duration
+	Policy         DisconnectPolicy
+	BufferSize     int     // Messages kept per port with PolicyBuffer
+	MaxRate        float64 // Updates per second per port, channel and controller, 0 for no limit
+}
+
+var DefaultWriterConfig = WriterConfig{
+	RescanInterval: 2 * time.Second,
+	Policy:         PolicyBuffer,
+	BufferSize:     256,
+}
+
+var writerConfig = DefaultWriterConfig
+
+// SetWriterConfig replaces DefaultWriterConfig. Call it before starting MidiWriter.
+func SetWriterConfig(c WriterConfig) {
+	writerConfig = c
+}
+
+// ParseDisconnectPolicy parses the disconnected_policy config value.
+func ParseDisconnectPolicy(s string) (DisconnectPolicy, error) {
+	switch p := DisconnectPolicy(s); p {
+	case PolicyDrop, PolicyBuffer:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy '%s' (drop, buffer)", s)
+}
+
+// PortStatus is reported by the HTTP API for every output port.
+type PortStatus struct {
+	Name      string    `json:"name"`
+	PortPath  string    `json:"port_path,omitempty"` // As selected in midi_ports.json
+	Virtual   bool      `json:"virtual"`
+	Connected bool      `json:"connected"`
+	OpenedAs  string    `json:"opened_as,omitempty"` // Port currently in use
+	Since     time.Time `json:"since"`               // Last change of Connected
+	Buffered  int       `json:"buffered"`
+	Dropped   uint64    `json:"dropped"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// managedPort is one wanted output, connected or not.
+type managedPort struct {
+	id        midiports.PortID
+	virtual   bool
+	out       drivers.Out
+	send      func(midi.Message) error
+	openedAs  string
+	connected bool
+	since     time.Time
+	buffer    [][]midi.Message // Groups of raw messages, e.g. the four of an NRPN
+	dropped   uint64
+	lastError string
+}
+
+type portSupervisor struct {
+	mu           sync.Mutex
+	ports        []*managedPort
+	virtualTried bool
+	virtualOK    bool
+	limiter      *rateLimiter // nil without a rate limit
+}
+
+var supervisor = &portSupervisor{}
+
+// OutputStatus reports the state of every output port.
+func OutputStatus() []PortStatus {
+	supervisor.mu.Lock()
+	defer supervisor.mu.Unlock()
+
+	list := make([]PortStatus, 0, len(supervisor.ports))
+	for _, p := range supervisor.ports {
+		list = append(list, p.status())
+	}
+	return list
+}
+
+func (p *managedPort) status() PortStatus {
+	buffered := 0
+	for _, group := range p.buffer {
+		buffered += len(group)
+	}
+	return PortStatus{
+		Name:      p.id.Name,
+		PortPath:  p.id.PortPath,
+		Virtual:   p.virtual,
+		Connected: p.connected,
+		OpenedAs:  p.openedAs,
+		Since:     p.since,
+		Buffered:  buffered,
+		Dropped:   p.dropped,
+		LastError: p.lastError,
+	}
+}
+
+var portEvents fanout.Fanout[PortStatus]
+
+// SubscribePorts returns a channel receiving the status of an output port whenever it
+// connects, disconnects or is no longer selected. Slow subscribers miss changes rather
+// than blocking the writer. Call cancel when done.
+func SubscribePorts() (changes <-chan PortStatus, cancel func()) {
+	return portEvents.Subscribe(32)
+}
+
+func notifyPort(p *managedPort) {
+	portEvents.Publish(p.status())
+}
+
+// rescan creates the virtual port once, follows changes of the selection and reopens
+// ports that were unplugged as soon as they are back.
+func (s *portSupervisor) rescan() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if virtualPortName != "" && !s.virtualTried {
+		s.virtualTried = true
+		s.openVirtual()
+	}
+
+	if wanted, err := s.wantedPorts(); err == nil {
+		s.reconcile(wanted)
+	}
+
+	outs := midi.GetOutPorts()
+	present := make(map[string]bool, len(outs))
+	for _, out := range outs {
+		present[out.String()] = true
+	}
+	ids := midiports.FromPorts(outs, midiports.DriverName())
+
+	for _, p := range s.ports {
+		if p.virtual {
+			continue
+		}
+		if p.connected && !present[p.openedAs] {
+			s.disconnect(p, fmt.Errorf("port disappeared"))
+		}
+		if p.connected {
+			continue
+		}
+
+		idx, kind, err := midiports.Match(p.id, ids)
+		if err != nil {
+			p.lastError = err.Error()
+			continue
+		}
+		if kind == midiports.MatchFuzzy {
+			// Possibly another device, only the user can tell
+			p.lastError = fmt.Sprintf("not found, %s matches loosely, select it to use it", outs[idx])
+			continue
+		}
+		if err := s.connect(p, outs[idx]); err != nil {
+			p.lastError = err.Error()
+			continue
+		}
+		log.Printf("Opened MIDI output port %s (%s match for %s)", outs[idx], kind, p.id)
+	}
+}
+
+func (s *portSupervisor) openVirtual() {
+	out, err := openVirtualOut(virtualPortName)
+	if err == nil {
+		var send func(midi.Message) error
+		if send, err = midi.SendTo(out); err == nil {
+			log.Printf("Created virtual MIDI output port %q", virtualPortName)
+			s.virtualOK = true
+			s.ports = append(s.ports, &managedPort{
+				id:        midiports.PortID{Name: virtualPortName},
+				virtual:   true,
+				out:       out,
+				send:      send,
+				openedAs:  virtualPortName,
+				connected: true,
+				since:     time.Now(),
+			})
+			return
+		}
+	}
+	log.Printf("Failed to create virtual MIDI output port %q: %v", virtualPortName, err)
+}
+
+// wantedPorts reads the ports listed in selected_midi_ports. The single
+// selected_midi_port is the fallback when neither they nor a virtual port exist, e.g. on
+// Windows where rtmidi has no virtual ports.
+func (s *portSupervisor) wantedPorts() ([]midiports.PortID, error) {
+	selection, err := getMIDIFileContent()
+	if err != nil {
+		return nil, err
+	}
+	wanted := selection.SelectedPorts
+	if len(wanted) == 0 && !s.virtualOK && (selection.SelectedPort.Name != "" || selection.SelectedPort.PortPath != "") {
+		wanted = []midiports.PortID{selection.SelectedPort}
+	}
+	return wanted, nil
+}
+
+// reconcile adds newly selected ports and closes ports that are no longer selected.
+func (s *portSupervisor) reconcile(wanted []midiports.PortID) {
+	isWanted := make(map[midiports.PortID]bool, len(wanted))
+	for _, id := range wanted {
+		isWanted[id] = true
+	}
+
+	kept := s.ports[:0]
+	existing := make(map[midiports.PortID]bool)
+	for _, p := range s.ports {
+		if !p.virtual && !isWanted[p.id] {
+			if p.connected {
+				p.out.Close()
+				p.connected = false
+				p.since = time.Now()
+				notifyPort(p)
+			}
+			if s.limiter != nil {
+				s.limiter.forget(p)
+			}
+			log.Printf("MIDI output port %s is no longer selected", p.id)
+			continue
+		}
+		existing[p.id] = true
+		kept = append(kept, p)
+	}
+	s.ports = kept
+
+	for _, id := range wanted {
+		if !existing[id] {
+			s.ports = append(s.ports, &managedPort{id: id, since: time.Now()})
+		}
+	}
+}
+
+func (s *portSupervisor) connect(p *managedPort, out drivers.Out) error {
+	send, err := midi.SendTo(out)
+	if err != nil {
+		return fmt.Errorf("error opening MIDI output port %s: %w", out, err)
+	}
+	p.out = out
+	p.send = send
+	p.openedAs = out.String()
+	p.connected = true
+	p.since = time.Now()
+	p.lastError = ""
+	notifyPort(p)
+
+	// Catch up on what was held back while the port was gone
+	buffer := p.buffer
+	p.buffer = nil
+	for _, group := range buffer {
+		s.sendGroup(p, group)
+	}
+	return nil
+}
+
+func (s *portSupervisor) disconnect(p *managedPort, cause error) {
+	log.Printf("MIDI output port %s disconnected: %v", p.id, cause)
+	p.out.Close()
+	p.connected = false
+	p.send = nil
+	p.since = time.Now()
+	p.lastError = cause.Error()
+	notifyPort(p)
+}
+
+// deliver sends raw to the ports named in ports, or to every port if ports is empty.
+// key identifies the controller for the rate limit, empty for messages that are never
+// held back such as notes.
+func (s *portSupervisor) deliver(ports []string, key string, raw []midi.Message, warned map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, p := range s.targets(ports, warned) {
+		if s.limiter != nil && key != "" && !s.limiter.admit(p, key, raw, now) {
+			continue
+		}
+		s.sendGroup(p, raw)
+	}
+}
+
+// flushDue sends the updates the rate limit held back once their interval has passed
+// and returns how long until the next one is due.
+func (s *portSupervisor) flushDue() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limiter == nil {
+		return 0, false
+	}
+	now := time.Now()
+	s.limiter.due(now, s.sendGroup)
+	return s.limiter.next(now)
+}
+
+// targets returns the ports a message goes to, matching names and port paths.
+func (s *portSupervisor) targets(names []string, warned map[string]bool) []*managedPort {
+	if len(names) == 0 {
+		return s.ports
+	}
+	var targets []*managedPort
+	for _, name := range names {
+		found := false
+		for _, p := range s.ports {
+			if p.id.Name == name || (p.id.PortPath != "" && p.id.PortPath == name) {
+				targets = append(targets, p)
+				found = true
+			}
+		}
+		if !found && !warned[name] {
+			log.Printf("Warning: MIDI output port %q is not selected, messages for it are dropped", name)
+			warned[name] = true
+		}
+	}
+	return targets
+}
+
+func (s *portSupervisor) sendGroup(p *managedPort, group []midi.Message) {
+	for i, m := range group {
+		if !p.connected {
+			s.hold(p, group[i:])
+			return
+		}
+		if err := p.send(m); err != nil {
+			log.Printf("Error sending message %v to %s: %v", m, p.id, err)
+			if !p.virtual {
+				s.disconnect(p, err)
+				s.hold(p, group[i:])
+				return
+			}
+		}
+	}
+}
+
+// hold applies the disconnect policy to messages for a port that is gone.
+func (s *portSupervisor) hold(p *managedPort, group []midi.Message) {
+	if writerConfig.Policy != PolicyBuffer || writerConfig.BufferSize <= 0 {
+		p.dropped += uint64(len(group))
+		return
+	}
+	if len(p.buffer) >= writerConfig.BufferSize {
+		p.dropped += uint64(len(p.buffer[0]))
+		p.buffer = p.buffer[1:]
+	}
+	p.buffer = append(p.buffer, append([]midi.Message{}, group...))
+}
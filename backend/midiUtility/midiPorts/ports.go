@@ -0,0 +1,221 @@
+// Package midiports identifies MIDI ports in a way that survives reboots and renumbering.
+//
+// rtmidi names ALSA ports "<client name>:<port name> <client>:<port>", e.g.
+// "Midi Through:Midi Through Port-0 14:0". The numbers change whenever devices are
+// plugged in a different order, and other platforms have no numbers at all, so a port
+// is found again by trying these rules in order:
+//
+//  1. exact: same name and same client:port numbers
+//  2. name: same name, numbers may differ
+//  3. fuzzy: one name contains all words of the other, ignoring case, punctuation and
+//     spacing, and both end in the same number if either does
+//
+// When several ports match equally well the one with the same numbers, or else the
+// same port number within its client, wins. A fuzzy match is only a suggestion, it may
+// well be another device, so it is never opened without the user selecting it.
+package midiports
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// PortID is what midi_ports.json stores about a port.
+type PortID struct {
+	Name     string `json:"name"`
+	PortPath string `json:"port_path,omitempty"` // "client:port", only known for ALSA
+	Driver   string `json:"driver,omitempty"`
+}
+
+// MatchKind tells which rule found a port.
+type MatchKind string
+
+const (
+	MatchExact MatchKind = "exact"
+	MatchName  MatchKind = "name"
+	MatchFuzzy MatchKind = "fuzzy"
+)
+
+// minFuzzyScore only lets names through whose words are all part of the other name,
+// see similarity. "Port-0" and "Port-1" of the same client score lower.
+const minFuzzyScore = 0.9
+
+var portPathPattern = regexp.MustCompile(`^\d+:\d+$`)
+
+// Parse splits a port as named by the driver into name and port path.
+func Parse(port string, driver string) PortID {
+	port = strings.TrimSpace(port)
+	id := PortID{Name: port, Driver: driver}
+	if i := strings.LastIndex(port, " "); i != -1 && portPathPattern.MatchString(port[i+1:]) {
+		id.Name = strings.TrimSpace(port[:i])
+		id.PortPath = port[i+1:]
+	}
+	return id
+}
+
+// FromPorts identifies every port of a driver port list, e.g. midi.GetOutPorts().
+func FromPorts[T fmt.Stringer](ports []T, driver string) []PortID {
+	ids := make([]PortID, len(ports))
+	for i, p := range ports {
+		ids[i] = Parse(p.String(), driver)
+	}
+	return ids
+}
+
+// DriverName returns the name of the registered MIDI driver, e.g. "rtmididrv".
+func DriverName() string {
+	if drv := drivers.Get(); drv != nil {
+		return drv.String()
+	}
+	return ""
+}
+
+// Numbers returns the ALSA client and port number.
+func (id PortID) Numbers() (client int, port int, ok bool) {
+	c, p, found := strings.Cut(id.PortPath, ":")
+	if !found {
+		return 0, 0, false
+	}
+	client, err1 := strconv.Atoi(c)
+	port, err2 := strconv.Atoi(p)
+	return client, port, err1 == nil && err2 == nil
+}
+
+func (id PortID) String() string {
+	if id.PortPath == "" {
+		return id.Name
+	}
+	return id.Name + " " + id.PortPath
+}
+
+// Match finds want among the available ports and returns its index.
+func Match(want PortID, available []PortID) (int, MatchKind, error) {
+	if want.Name == "" {
+		// Files written before ports were identified by name only know the numbers
+		for i, p := range available {
+			if want.PortPath != "" && p.PortPath == want.PortPath {
+				return i, MatchExact, nil
+			}
+		}
+		return -1, "", fmt.Errorf("no port at %s", want.PortPath)
+	}
+
+	for i, p := range available {
+		if p.Name == want.Name && p.PortPath == want.PortPath && sameDriver(p, want) {
+			return i, MatchExact, nil
+		}
+	}
+
+	var byName []int
+	for i, p := range available {
+		if p.Name == want.Name {
+			byName = append(byName, i)
+		}
+	}
+	if len(byName) > 0 {
+		return closest(want, available, byName), MatchName, nil
+	}
+
+	wantWords := words(want.Name)
+	best := 0.0
+	var byFuzzy []int
+	for i, p := range available {
+		pWords := words(p.Name)
+		score := similarity(wantWords, pWords)
+		if score < minFuzzyScore || score < best || !sameSuffix(wantWords, pWords) {
+			continue
+		}
+		if score > best {
+			best = score
+			byFuzzy = byFuzzy[:0]
+		}
+		byFuzzy = append(byFuzzy, i)
+	}
+	if len(byFuzzy) > 0 {
+		return closest(want, available, byFuzzy), MatchFuzzy, nil
+	}
+
+	return -1, "", fmt.Errorf("no port matches %q", want.Name)
+}
+
+// sameSuffix reports whether two names end in the same number, or both in none. The
+// number tells ports and devices of the same kind apart, e.g. "Port-0" and "Port-1".
+func sameSuffix(a, b []string) bool {
+	number := func(list []string) string {
+		if len(list) == 0 {
+			return ""
+		}
+		last := list[len(list)-1]
+		if _, err := strconv.Atoi(last); err != nil {
+			return ""
+		}
+		return last
+	}
+	return number(a) == number(b)
+}
+
+func sameDriver(a, b PortID) bool {
+	return a.Driver == "" || b.Driver == "" || a.Driver == b.Driver
+}
+
+// closest picks among equally good candidates the one with the same numbers, then the
+// one with the same port number, then the first.
+func closest(want PortID, available []PortID, candidates []int) int {
+	for _, i := range candidates {
+		if want.PortPath != "" && available[i].PortPath == want.PortPath {
+			return i
+		}
+	}
+	if _, wantPort, ok := want.Numbers(); ok {
+		for _, i := range candidates {
+			if _, port, ok := available[i].Numbers(); ok && port == wantPort {
+				return i
+			}
+		}
+	}
+	return candidates[0]
+}
+
+// words splits a name into lower case words, e.g. "Midi Through:Midi Through Port-0"
+// into midi, through, midi, through, port, 0.
+func words(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// similarity is 1 for names with the same words and drops with every word only one
+// of them has. A name whose words are all part of the other one scores at least 0.9,
+// which catches names shortened or extended by the driver.
+func similarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if strings.Join(a, "") == strings.Join(b, "") {
+		return 1
+	}
+
+	count := func(list []string) map[string]int {
+		m := make(map[string]int)
+		for _, w := range list {
+			m[w]++
+		}
+		return m
+	}
+	ca, cb := count(a), count(b)
+	common := 0
+	for w, n := range ca {
+		common += min(n, cb[w])
+	}
+	union := len(a) + len(b) - common
+
+	if common == len(a) || common == len(b) {
+		return 0.9 + 0.09*float64(common)/float64(union)
+	}
+	return float64(common) / float64(union)
+}
@@ -0,0 +1,124 @@
+package midiports
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		port string
+		want PortID
+	}{
+		{"Midi Through:Midi Through Port-0 14:0", PortID{Name: "Midi Through:Midi Through Port-0", PortPath: "14:0"}},
+		{"loopMIDI Port 1", PortID{Name: "loopMIDI Port 1"}},
+		{"  IAC Driver Bus 1  ", PortID{Name: "IAC Driver Bus 1"}},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.port, ""); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	through0 := PortID{Name: "Midi Through:Midi Through Port-0", PortPath: "14:0"}
+	through1 := PortID{Name: "Midi Through:Midi Through Port-1", PortPath: "14:1"}
+	synth := PortID{Name: "USB Synth:USB Synth MIDI 1", PortPath: "24:0"}
+	synthMoved := PortID{Name: "USB Synth:USB Synth MIDI 1", PortPath: "28:0"}
+
+	tests := []struct {
+		name      string
+		want      PortID
+		available []PortID
+		index     int
+		kind      MatchKind
+		notFound  bool
+	}{
+		{
+			name:      "exact",
+			want:      through0,
+			available: []PortID{through1, through0},
+			index:     1,
+			kind:      MatchExact,
+		},
+		{
+			name:      "renumbered port matches by name",
+			want:      synth,
+			available: []PortID{through0, synthMoved},
+			index:     1,
+			kind:      MatchName,
+		},
+		{
+			name: "same name prefers the same port number",
+			want: PortID{Name: "Dual", PortPath: "20:1"},
+			available: []PortID{
+				{Name: "Dual", PortPath: "32:0"},
+				{Name: "Dual", PortPath: "32:1"},
+			},
+			index: 1,
+			kind:  MatchName,
+		},
+		{
+			name:      "driver must agree for an exact match",
+			want:      PortID{Name: "Bus 1", Driver: "rtmididrv"},
+			available: []PortID{{Name: "Bus 1", Driver: "webmididrv"}},
+			index:     0,
+			kind:      MatchName,
+		},
+		{
+			name:      "shortened name is a fuzzy match",
+			want:      PortID{Name: "USB Synth MIDI 1"},
+			available: []PortID{through0, synth},
+			index:     1,
+			kind:      MatchFuzzy,
+		},
+		{
+			name:      "another port of the same client is no match",
+			want:      through0,
+			available: []PortID{through1},
+			notFound:  true,
+		},
+		{
+			name:      "a different trailing number is no match",
+			want:      PortID{Name: "USB Synth MIDI 1"},
+			available: []PortID{{Name: "USB Synth MIDI 2"}},
+			notFound:  true,
+		},
+		{
+			name:      "a number only one name has is no match",
+			want:      PortID{Name: "Launchpad"},
+			available: []PortID{{Name: "Launchpad 2"}},
+			notFound:  true,
+		},
+		{
+			name:      "sharing some words is no match",
+			want:      PortID{Name: "Arturia KeyStep"},
+			available: []PortID{{Name: "Arturia BeatStep"}},
+			notFound:  true,
+		},
+		{
+			name:      "files without names match by numbers",
+			want:      PortID{PortPath: "24:0"},
+			available: []PortID{through0, synth},
+			index:     1,
+			kind:      MatchExact,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, kind, err := Match(tt.want, tt.available)
+			if tt.notFound {
+				if err == nil {
+					t.Fatalf("Match = %d (%s), want no match", index, kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Match: %v", err)
+			}
+			if index != tt.index || kind != tt.kind {
+				t.Errorf("Match = %d (%s), want %d (%s)", index, kind, tt.index, tt.kind)
+			}
+		})
+	}
+}
@@ -4,19 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	getvalues "modularMidiGoApp/backend/getValues"
+	midiports "modularMidiGoApp/backend/midiUtility/midiPorts"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"gitlab.com/gomidi/midi/v2"
 	_ "gitlab.com/gomidi/midi/v2/drivers/rtmididrv"
 )
 
-type USBDevice struct {
-	Name     string `json:"name"`
-	PortPath string `json:"port_path"`
-}
-
 var (
 	rootPath = getvalues.FindRootPath()
 	dirPath  = filepath.Join(rootPath, "midiUtility")
@@ -24,17 +19,17 @@ var (
 )
 
 func ListMIDIPorts() string {
-	writeToFile(readMIDIPorts())
+	writeToFile(readMIDIPorts(), readMIDIInPorts())
 	return filePath
 }
 
-func readMIDIPorts() string {
+func readMIDIPorts() []midiports.PortID {
 	// Get available MIDI output ports
 	outs := midi.GetOutPorts()
 
 	if len(outs) == 0 {
 		fmt.Print("No MIDI output ports available")
-		return ""
+		return nil
 	}
 
 	fmt.Printf("Found %d MIDI output ports\n", len(outs)) // Debug output
@@ -42,39 +37,15 @@ func readMIDIPorts() string {
 		fmt.Printf("Port %d: %s\n", i+1, out.String()) // Debug output
 	}
 
-	var portList string
-	for i, out := range outs {
-		portList += fmt.Sprintf("%d: %s\n", i+1, out.String())
-	}
-
-	return portList
+	return midiports.FromPorts(outs, midiports.DriverName())
 }
 
-func parseMIDIPorts(dataStr string) []USBDevice {
-	var devices []USBDevice
-	lines := strings.Split(strings.TrimSpace(dataStr), "\n")
-	for _, line := range lines {
-		// Example: "Port 1: Midi Through:Midi Through Port-0 14:0"
-		parts := strings.SplitN(line, ": ", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		portInfo := parts[1]
-		lastSpace := strings.LastIndex(portInfo, " ")
-		if lastSpace == -1 {
-			continue
-		}
-		name := portInfo[:lastSpace]
-		portPath := portInfo[lastSpace+1:]
-		devices = append(devices, USBDevice{
-			Name:     name,
-			PortPath: portPath,
-		})
-	}
-	return devices
+// readMIDIInPorts lists the input ports the feedback from the DAW can be read from.
+func readMIDIInPorts() []midiports.PortID {
+	return midiports.FromPorts(midi.GetInPorts(), midiports.DriverName())
 }
 
-func writeToFile(dataStr string) error {
+func writeToFile(outs []midiports.PortID, ins []midiports.PortID) error {
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
@@ -90,8 +61,8 @@ func writeToFile(dataStr string) error {
 		fileData = make(map[string]interface{})
 	}
 
-	devices := parseMIDIPorts(dataStr)
-	fileData["available_midi_ports"] = devices
+	fileData["available_midi_ports"] = outs
+	fileData["available_midi_in_ports"] = ins
 
 	finalData, err := json.MarshalIndent(fileData, "", "  ")
 	if err != nil {
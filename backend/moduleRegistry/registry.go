@@ -0,0 +1,280 @@
+// Package moduleregistry keeps track of the modules attached to the driver and of the
+// chain they are connected in.
+package moduleregistry
+
+import (
+	"log"
+	"modularMidiGoApp/backend/fanout"
+	serialprotocol "modularMidiGoApp/backend/usbUtility/serialProtocol"
+	"sort"
+	"sync"
+	"time"
+)
+
+// descriptorRetry is how long to wait for a descriptor before asking a module again.
+const descriptorRetry = 2 * time.Second
+
+// Module is one attached module. Mappings and feedback only know the module ID, so every
+// module needs its own ID across all sources, e.g. each ESP32 on Wi-Fi a different
+// MODULE_ID. A module using the ID of a module attached through another source is ignored
+// until that one is gone.
+type Module struct {
+	ID     uint8  `json:"id"`
+	Source string `json:"source"` // Transport, "usb" or "udp:<address>"
+	// Parent is the next module towards the PC, nil for the module connected to the PC.
+	Parent    *uint8    `json:"parent"`
+	HopPath   []uint8   `json:"hop_path"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Descriptor is nil until the module described itself
+	Descriptor *serialprotocol.Descriptor `json:"descriptor"`
+
+	descriptorRequested time.Time
+}
+
+// Event kinds sent to subscribers.
+const (
+	EventJoin      = "join"
+	EventLeave     = "leave"
+	EventMoved     = "moved"     // The module is reached through a different path now
+	EventDescribed = "described" // The module sent its descriptor
+)
+
+// ModuleEvent is sent to subscribers whenever a module joins, leaves or moves.
+type ModuleEvent struct {
+	Kind   string    `json:"kind"`
+	Module Module    `json:"module"`
+	Time   time.Time `json:"time"`
+}
+
+type moduleKey struct {
+	source string
+	id     uint8
+}
+
+var (
+	mu        sync.Mutex
+	modules   = make(map[moduleKey]*Module)
+	changes   fanout.Fanout[ModuleEvent]
+	conflicts = make(map[moduleKey]bool) // Modules ignored for a duplicate ID, logged once
+)
+
+// Seen records a frame from a module, which joins if it wasn't known yet. It returns
+// false if another source already has a module with the ID, the frame must be ignored then.
+func Seen(source string, id uint8, hopPath []uint8) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	key := moduleKey{source, id}
+	m, ok := modules[key]
+	if !ok {
+		for other := range modules {
+			if other.id == id && other.source != source {
+				if !conflicts[key] {
+					log.Printf("Warning: module %d on %s ignored, %s already has a module with that ID. Give every module its own ID.", id, source, other.source)
+					conflicts[key] = true
+				}
+				return false
+			}
+		}
+		delete(conflicts, key)
+		m = &Module{ID: id, Source: source, FirstSeen: now}
+		setPath(m, hopPath)
+		m.LastSeen = now
+		modules[key] = m
+		notify(EventJoin, *m)
+		return true
+	}
+
+	m.LastSeen = now
+	if !samePath(m.HopPath, hopPath) {
+		setPath(m, hopPath)
+		notify(EventMoved, *m)
+	}
+	return true
+}
+
+// SetDescriptor stores what a module reported about itself.
+func SetDescriptor(source string, id uint8, d serialprotocol.Descriptor) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	m, ok := modules[moduleKey{source, id}]
+	if !ok {
+		return
+	}
+	m.Descriptor = &d
+	notify(EventDescribed, *m)
+}
+
+// NeedsDescriptor reports whether a module should be asked for its descriptor.
+// It returns true at most once per descriptorRetry for every module.
+func NeedsDescriptor(source string, id uint8) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	m, ok := modules[moduleKey{source, id}]
+	if !ok || m.Descriptor != nil {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(m.descriptorRequested) < descriptorRetry {
+		return false
+	}
+	m.descriptorRequested = now
+	return true
+}
+
+// Leave removes a module and every module that was reached through it.
+func Leave(source string, id uint8) {
+	mu.Lock()
+	defer mu.Unlock()
+	leave(source, id)
+}
+
+// SourceLost removes all modules of a transport, e.g. after the USB connection broke.
+func SourceLost(source string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for key := range modules {
+		if key.source == source {
+			leave(source, key.id)
+		}
+	}
+	for key := range conflicts {
+		if key.source == source {
+			delete(conflicts, key)
+		}
+	}
+	delete(writers, source)
+}
+
+// Lookup finds a module by ID. Seen keeps IDs unique across sources.
+func Lookup(id uint8) (Module, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for key, m := range modules {
+		if key.id == id {
+			return copyModule(m), true
+		}
+	}
+	return Module{}, false
+}
+
+// Modules lists all attached modules sorted by source and ID.
+func Modules() []Module {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := make([]Module, 0, len(modules))
+	for _, m := range modules {
+		list = append(list, copyModule(m))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Source != list[j].Source {
+			return list[i].Source < list[j].Source
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Subscribe returns a channel receiving join, leave and move events. Slow subscribers
+// miss events rather than blocking the listeners. Call cancel when done.
+func Subscribe() (events <-chan ModuleEvent, cancel func()) {
+	return changes.Subscribe(32)
+}
+
+// ModuleWatcher removes modules that were silent for longer than timeout.
+// Modules send a heartbeat about once a second. A timeout of 0 disables the watcher.
+func ModuleWatcher(timeout time.Duration, stopChan <-chan struct{}) {
+	if timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case now := <-ticker.C:
+			mu.Lock()
+			for key, m := range modules {
+				if now.Sub(m.LastSeen) > timeout {
+					log.Printf("Module %d on %s timed out", key.id, key.source)
+					leave(key.source, key.id)
+				}
+			}
+			mu.Unlock()
+		}
+	}
+}
+
+// leave must be called with mu held.
+func leave(source string, id uint8) {
+	m, ok := modules[moduleKey{source, id}]
+	if !ok {
+		return
+	}
+	delete(modules, moduleKey{source, id})
+	notify(EventLeave, *m)
+
+	// Modules behind the one that left are gone as well
+	for key, other := range modules {
+		if key.source != source {
+			continue
+		}
+		for _, hop := range other.HopPath {
+			if hop == id {
+				leave(source, key.id)
+				break
+			}
+		}
+	}
+}
+
+// notify must be called with mu held.
+func notify(kind string, m Module) {
+	log.Printf("Module %d on %s: %s (path %v)", m.ID, m.Source, kind, m.HopPath)
+	changes.Publish(ModuleEvent{Kind: kind, Module: copyModule(&m), Time: time.Now()})
+}
+
+func setPath(m *Module, hopPath []uint8) {
+	m.HopPath = append([]uint8{}, hopPath...)
+	m.Parent = nil
+	if len(hopPath) > 0 {
+		parent := hopPath[0]
+		m.Parent = &parent
+	}
+}
+
+func samePath(a, b []uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func copyModule(m *Module) Module {
+	c := *m
+	c.HopPath = append([]uint8{}, m.HopPath...)
+	if m.Parent != nil {
+		parent := *m.Parent
+		c.Parent = &parent
+	}
+	if m.Descriptor != nil {
+		d := *m.Descriptor
+		d.Controls = append([]serialprotocol.ControlDescriptor{}, m.Descriptor.Controls...)
+		c.Descriptor = &d
+	}
+	return c
+}
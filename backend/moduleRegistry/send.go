@@ -0,0 +1,64 @@
+package moduleregistry
+
+import (
+	"fmt"
+	"io"
+	serialprotocol "modularMidiGoApp/backend/usbUtility/serialProtocol"
+	"sync"
+)
+
+// writers holds the connection of every source, guarded by mu.
+var writers = make(map[string]*lockedWriter)
+
+// lockedWriter keeps frames sent from several goroutines from interleaving.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(data []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(data)
+}
+
+// SetWriter registers the connection frames for the modules of a source are written to.
+// It is removed again by SourceLost.
+func SetWriter(source string, w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	writers[source] = &lockedWriter{w: w}
+}
+
+// SendFrame writes a frame to a source. frame.HopPath must lead to frame.ModuleID.
+func SendFrame(source string, frame serialprotocol.Frame) error {
+	mu.Lock()
+	w, ok := writers[source]
+	mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no connection for source %s", source)
+	}
+
+	data, err := serialprotocol.Encode(frame)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send %s to module %d on %s: %w", frame.Type, frame.ModuleID, source, err)
+	}
+	return nil
+}
+
+// SendToModule routes a frame to a module by its ID, using the path it was last seen on.
+func SendToModule(id uint8, msgType serialprotocol.MessageType, payload []byte) error {
+	m, ok := Lookup(id)
+	if !ok {
+		return fmt.Errorf("module %d is not attached", id)
+	}
+	return SendFrame(m.Source, serialprotocol.Frame{
+		ModuleID: id,
+		Type:     msgType,
+		Payload:  payload,
+		HopPath:  m.HopPath,
+	})
+}
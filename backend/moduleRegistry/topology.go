@@ -0,0 +1,53 @@
+package moduleregistry
+
+// TopologyNode is a module with the modules attached behind it.
+type TopologyNode struct {
+	ID       uint8           `json:"id"`
+	Children []*TopologyNode `json:"children"`
+}
+
+// SourceTopology is the chain of modules reached through one transport.
+type SourceTopology struct {
+	Source string          `json:"source"`
+	Roots  []*TopologyNode `json:"roots"`
+}
+
+// Topology is returned by the HTTP API so the GUI can draw the chain.
+type Topology struct {
+	Modules []Module         `json:"modules"`
+	Sources []SourceTopology `json:"sources"`
+}
+
+// GetTopology builds the module tree of every source.
+func GetTopology() Topology {
+	list := Modules()
+
+	nodes := make(map[moduleKey]*TopologyNode, len(list))
+	for _, m := range list {
+		nodes[moduleKey{m.Source, m.ID}] = &TopologyNode{ID: m.ID, Children: []*TopologyNode{}}
+	}
+
+	topology := Topology{Modules: list, Sources: []SourceTopology{}}
+	sourceIndex := make(map[string]int)
+
+	// list is sorted, so children end up in ID order
+	for _, m := range list {
+		node := nodes[moduleKey{m.Source, m.ID}]
+		if m.Parent != nil {
+			if parent, ok := nodes[moduleKey{m.Source, *m.Parent}]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+			// The parent hasn't been seen yet, show the module as a root until it is
+		}
+
+		i, ok := sourceIndex[m.Source]
+		if !ok {
+			i = len(topology.Sources)
+			sourceIndex[m.Source] = i
+			topology.Sources = append(topology.Sources, SourceTopology{Source: m.Source})
+		}
+		topology.Sources[i].Roots = append(topology.Sources[i].Roots, node)
+	}
+	return topology
+}
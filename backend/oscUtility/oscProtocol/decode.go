@@ -0,0 +1,136 @@
+package oscprotocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// bundleTag starts every bundle, followed by a time tag and the size prefixed elements.
+const bundleTag = "#bundle"
+
+// ParsePacket decodes the content of one UDP packet, a message or a bundle. The messages of
+// bundles are returned in order and handled right away, time tags are ignored.
+func ParsePacket(data []byte) ([]Message, error) {
+	if !bytes.HasPrefix(data, []byte(bundleTag+"\x00")) {
+		m, err := Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Message{m}, nil
+	}
+
+	if len(data) < 16 {
+		return nil, fmt.Errorf("OSC bundle too short: %d bytes", len(data))
+	}
+	var messages []Message
+	rest := data[16:] // Tag and time tag
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("truncated OSC bundle element")
+		}
+		size := int(binary.BigEndian.Uint32(rest))
+		if size%4 != 0 || size > len(rest)-4 {
+			return nil, fmt.Errorf("invalid OSC bundle element size %d", size)
+		}
+		inner, err := ParsePacket(rest[4 : 4+size])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, inner...)
+		rest = rest[4+size:]
+	}
+	return messages, nil
+}
+
+// Decode parses a single message. Besides the types Encode writes it accepts int64 (h),
+// float64 (d), symbols (S), nil (N) and impulses (I), the last two as nil.
+func Decode(data []byte) (Message, error) {
+	address, rest, err := readString(data)
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid OSC address: %w", err)
+	}
+	if len(address) == 0 || address[0] != '/' {
+		return Message{}, fmt.Errorf("OSC address '%s' must start with '/'", address)
+	}
+	m := Message{Address: address}
+	if len(rest) == 0 {
+		// Very old senders leave out the type tags of messages without arguments
+		return m, nil
+	}
+
+	tags, rest, err := readString(rest)
+	if err != nil {
+		return Message{}, fmt.Errorf("invalid OSC type tags: %w", err)
+	}
+	if len(tags) == 0 || tags[0] != ',' {
+		return Message{}, fmt.Errorf("OSC type tags '%s' must start with ','", tags)
+	}
+
+	for _, tag := range []byte(tags[1:]) {
+		var arg any
+		switch tag {
+		case 'i', 'f':
+			if len(rest) < 4 {
+				return Message{}, fmt.Errorf("truncated OSC argument '%c'", tag)
+			}
+			bits := binary.BigEndian.Uint32(rest)
+			if tag == 'i' {
+				arg = int32(bits)
+			} else {
+				arg = math.Float32frombits(bits)
+			}
+			rest = rest[4:]
+		case 'h', 'd':
+			if len(rest) < 8 {
+				return Message{}, fmt.Errorf("truncated OSC argument '%c'", tag)
+			}
+			bits := binary.BigEndian.Uint64(rest)
+			if tag == 'h' {
+				arg = int64(bits)
+			} else {
+				arg = math.Float64frombits(bits)
+			}
+			rest = rest[8:]
+		case 's', 'S':
+			arg, rest, err = readString(rest)
+			if err != nil {
+				return Message{}, fmt.Errorf("invalid OSC string argument: %w", err)
+			}
+		case 'b':
+			if len(rest) < 4 {
+				return Message{}, fmt.Errorf("truncated OSC blob")
+			}
+			size := int(binary.BigEndian.Uint32(rest))
+			padded := (size + 3) &^ 3
+			if padded > len(rest)-4 {
+				return Message{}, fmt.Errorf("truncated OSC blob of %d bytes", size)
+			}
+			arg = append([]byte{}, rest[4:4+size]...)
+			rest = rest[4+padded:]
+		case 'T':
+			arg = true
+		case 'F':
+			arg = false
+		case 'N', 'I':
+		default:
+			return Message{}, fmt.Errorf("unsupported OSC type tag '%c'", tag)
+		}
+		m.Args = append(m.Args, arg)
+	}
+	return m, nil
+}
+
+// readString reads a zero terminated, padded string and returns the data after it.
+func readString(data []byte) (string, []byte, error) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", nil, fmt.Errorf("missing zero byte")
+	}
+	padded := (end + 4) &^ 3
+	if padded > len(data) {
+		return "", nil, fmt.Errorf("missing padding")
+	}
+	return string(data[:end]), data[padded:], nil
+}
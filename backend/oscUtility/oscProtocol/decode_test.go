@@ -0,0 +1,154 @@
+package oscprotocol
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeRoundTrip(t *testing.T) {
+	messages := []Message{
+		{Address: "/ping"},
+		{Address: "/module/3/fader/1", Args: []any{float32(0.25)}},
+		{Address: "/preset", Args: []any{"live", int32(7), []byte{9, 8, 7}, true, false}},
+	}
+
+	for _, want := range messages {
+		data, err := Encode(want)
+		if err != nil {
+			t.Fatalf("Encode(%+v): %v", want, err)
+		}
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatalf("Decode(% x): %v", data, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Decode(Encode(%+v)) = %+v", want, got)
+		}
+	}
+}
+
+func TestDecodeOtherTypes(t *testing.T) {
+	data := []byte("/x\x00\x00,hdSNI\x00\x00")
+	data = binary.BigEndian.AppendUint64(data, uint64(1)<<40)
+	data = binary.BigEndian.AppendUint64(data, math.Float64bits(0.75))
+	data = append(data, "sym\x00"...)
+
+	got, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := Message{Address: "/x", Args: []any{int64(1) << 40, 0.75, "sym", nil, nil}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeWithoutTypeTags(t *testing.T) {
+	got, err := Decode([]byte("/go\x00"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got.Address != "/go" || len(got.Args) != 0 {
+		t.Errorf("Decode = %+v, want /go without arguments", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"address without zero byte", "/abc"},
+		{"address without '/'", "abc\x00,\x00\x00\x00"},
+		{"type tags without ','", "/a\x00\x00f\x00\x00\x00"},
+		{"truncated float", "/a\x00\x00,f\x00\x00\x00\x00"},
+		{"truncated blob", "/a\x00\x00,b\x00\x00\x00\x00\x00\x08\x01\x02\x03\x04"},
+		{"unknown type tag", "/a\x00\x00,z\x00\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := Decode([]byte(tt.data)); err == nil {
+				t.Errorf("Decode accepted % x as %+v", tt.data, m)
+			}
+		})
+	}
+}
+
+// bundle builds a bundle with an immediate time tag around the given elements.
+func bundle(elements ...[]byte) []byte {
+	data := []byte(bundleTag + "\x00")
+	data = binary.BigEndian.AppendUint64(data, 1)
+	for _, e := range elements {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(e)))
+		data = append(data, e...)
+	}
+	return data
+}
+
+func TestParsePacket(t *testing.T) {
+	encode := func(m Message) []byte {
+		data, err := Encode(m)
+		if err != nil {
+			t.Fatalf("Encode(%+v): %v", m, err)
+		}
+		return data
+	}
+	a := Message{Address: "/a", Args: []any{int32(1)}}
+	b := Message{Address: "/b", Args: []any{float32(0.5)}}
+	c := Message{Address: "/c"}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []Message
+	}{
+		{"single message", encode(a), []Message{a}},
+		{"bundle", bundle(encode(a), encode(b)), []Message{a, b}},
+		{"nested bundle keeps the order", bundle(encode(a), bundle(encode(b), encode(c))), []Message{a, b, c}},
+		{"empty bundle", bundle(), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePacket(tt.data)
+			if err != nil {
+				t.Fatalf("ParsePacket: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePacket = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePacketErrors(t *testing.T) {
+	valid, err := Encode(Message{Address: "/a"})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	oversized := bundle(valid)
+	binary.BigEndian.PutUint32(oversized[16:], 64)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"bundle without time tag", []byte(bundleTag + "\x00\x00\x00\x00\x00")},
+		{"truncated element size", append(bundle(), 0, 0)},
+		{"element larger than the bundle", oversized},
+		{"element size not a multiple of four", append(bundle(), 0, 0, 0, 3, '/', 'a', 0)},
+		{"invalid message in bundle", bundle([]byte("bad\x00"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePacket(tt.data); err == nil {
+				t.Errorf("ParsePacket accepted % x", tt.data)
+			}
+		})
+	}
+}
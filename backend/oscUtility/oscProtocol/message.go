@@ -0,0 +1,72 @@
+// Package oscprotocol encodes and decodes Open Sound Control 1.0 messages as sent over UDP.
+//
+// A message is its address, a type tag string starting with ',' and the arguments, each
+// part padded with zero bytes to a multiple of four bytes:
+//
+//	| "/module/3/fader/1\0..." | ",f\0\0" | float32 big endian |
+package oscprotocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Message is one OSC message. Args may hold int32, float32, string, []byte (blob) and bool.
+type Message struct {
+	Address string
+	Args    []any
+}
+
+// Encode serialises a message.
+func Encode(m Message) ([]byte, error) {
+	if !strings.HasPrefix(m.Address, "/") {
+		return nil, fmt.Errorf("OSC address '%s' must start with '/'", m.Address)
+	}
+
+	tags := []byte{','}
+	var args []byte
+	for _, arg := range m.Args {
+		switch v := arg.(type) {
+		case int32:
+			tags = append(tags, 'i')
+			args = binary.BigEndian.AppendUint32(args, uint32(v))
+		case float32:
+			tags = append(tags, 'f')
+			args = binary.BigEndian.AppendUint32(args, math.Float32bits(v))
+		case string:
+			tags = append(tags, 's')
+			args = appendString(args, v)
+		case []byte:
+			tags = append(tags, 'b')
+			args = binary.BigEndian.AppendUint32(args, uint32(len(v)))
+			args = appendPadded(args, v)
+		case bool:
+			if v {
+				tags = append(tags, 'T')
+			} else {
+				tags = append(tags, 'F')
+			}
+		default:
+			return nil, fmt.Errorf("unsupported OSC argument type %T", arg)
+		}
+	}
+
+	data := appendString(nil, m.Address)
+	data = appendString(data, string(tags))
+	return append(data, args...), nil
+}
+
+// appendString adds a string with its terminating zero byte and padding.
+func appendString(data []byte, s string) []byte {
+	return appendPadded(data, append([]byte(s), 0))
+}
+
+func appendPadded(data []byte, b []byte) []byte {
+	data = append(data, b...)
+	for n := len(b); n%4 != 0; n++ {
+		data = append(data, 0)
+	}
+	return data
+}
@@ -0,0 +1,59 @@
+package oscprotocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Message
+		want []byte
+	}{
+		{
+			name: "no arguments",
+			m:    Message{Address: "/ping"},
+			want: []byte("/ping\x00\x00\x00,\x00\x00\x00"),
+		},
+		{
+			name: "float with padded address",
+			m:    Message{Address: "/module/3/fader/1", Args: []any{float32(0.5)}},
+			want: []byte("/module/3/fader/1\x00\x00\x00,f\x00\x00\x3f\x00\x00\x00"),
+		},
+		{
+			name: "int and string",
+			m:    Message{Address: "/abc", Args: []any{int32(-2), "hi"}},
+			want: []byte("/abc\x00\x00\x00\x00,is\x00\xff\xff\xff\xfehi\x00\x00"),
+		},
+		{
+			name: "blob and booleans",
+			m:    Message{Address: "/b", Args: []any{[]byte{1, 2, 3, 4, 5}, true, false}},
+			want: []byte("/b\x00\x00,bTF\x00\x00\x00\x00\x00\x00\x00\x05\x01\x02\x03\x04\x05\x00\x00\x00"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Encode(tt.m)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Encode = % x, want % x", got, tt.want)
+			}
+			if len(got)%4 != 0 {
+				t.Errorf("Encode returned %d bytes, not a multiple of four", len(got))
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	if _, err := Encode(Message{Address: "module/1"}); err == nil {
+		t.Error("Encode accepted an address without '/'")
+	}
+	if _, err := Encode(Message{Address: "/a", Args: []any{1.5}}); err == nil {
+		t.Error("Encode accepted a float64 argument")
+	}
+}
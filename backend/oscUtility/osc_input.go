@@ -0,0 +1,207 @@
+package oscUtility
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	oscprotocol "modularMidiGoApp/backend/oscUtility/oscProtocol"
+)
+
+// OSCListener receives OSC messages on the given port for show control. Understood
+// addresses:
+//
+//	/control/<module>/<control> <value>        control value from 0 to 1, mapped like one from the module
+//	/control/<module>/<control>/delta <steps>  encoder movement
+//	/led/<module>/<control> <value>            LED or motorised fader of a control, 0 to 1
+//	/preset <name>                             activates a preset
+//	/preset/next                               activates the next preset
+//
+// Values may be sent as float, int or bool. Address patterns with wildcards aren't supported.
+func OSCListener(port string, eventChan chan<- controlmapping.ControlEvent, stopChan <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("OSCListener recovered from panic: %v", r)
+		}
+	}()
+
+	for {
+		select {
+		case <-stopChan:
+			log.Println("OSCListener stopping...")
+			return
+		default:
+			if err := listenOSC(port, eventChan, stopChan); err != nil {
+				log.Printf("OSC listener error: %v", err)
+				log.Println("Retrying in 5 seconds...")
+
+				select {
+				case <-time.After(5 * time.Second):
+					continue
+				case <-stopChan:
+					return
+				}
+			}
+		}
+	}
+}
+
+func listenOSC(port string, eventChan chan<- controlmapping.ControlEvent, stopChan <-chan struct{}) error {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP port %s: %w", port, err)
+	}
+	defer conn.Close()
+
+	log.Printf("Listening for OSC on UDP port %s", port)
+
+	// Close the socket on stop so ReadFrom returns
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stopChan:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-stopChan:
+				log.Println("Stopping OSC listener...")
+				return nil
+			default:
+			}
+			return fmt.Errorf("failed to read from UDP socket: %w", err)
+		}
+
+		messages, err := oscprotocol.ParsePacket(buf[:n])
+		if err != nil {
+			log.Printf("Invalid OSC packet from %s: %v", addr, err)
+			continue
+		}
+		for _, m := range messages {
+			if err := handleOSC(m, eventChan); err != nil {
+				log.Printf("OSC message %s from %s: %v", m.Address, addr, err)
+			}
+		}
+	}
+}
+
+// handleOSC carries out one message, see OSCListener for the addresses.
+func handleOSC(m oscprotocol.Message, eventChan chan<- controlmapping.ControlEvent) error {
+	parts := strings.Split(strings.TrimPrefix(m.Address, "/"), "/")
+
+	switch {
+	case parts[0] == "preset" && len(parts) == 1:
+		if len(m.Args) != 1 {
+			return fmt.Errorf("expected the preset name")
+		}
+		name, ok := m.Args[0].(string)
+		if !ok {
+			return fmt.Errorf("expected the preset name as string, got %T", m.Args[0])
+		}
+		return controlmapping.ActivatePreset(name)
+
+	case parts[0] == "preset" && len(parts) == 2 && parts[1] == "next":
+		return controlmapping.ActivateNextPreset()
+
+	case parts[0] == "led" && len(parts) == 3:
+		module, control, err := parseControl(parts[1], parts[2])
+		if err != nil {
+			return err
+		}
+		value, err := numberArg(m)
+		if err != nil {
+			return err
+		}
+		if !(value >= 0 && value <= 1) {
+			return fmt.Errorf("value %g out of range (0-1)", value)
+		}
+		return controlmapping.SendToControl(module, control, value)
+
+	case parts[0] == "control" && (len(parts) == 3 || len(parts) == 4 && parts[3] == "delta"):
+		module, control, err := parseControl(parts[1], parts[2])
+		if err != nil {
+			return err
+		}
+		value, err := numberArg(m)
+		if err != nil {
+			return err
+		}
+		ev := controlmapping.ControlEvent{ModuleID: module, ControlID: control, Source: "osc"}
+		if len(parts) == 4 {
+			// NaN fails the comparison as well
+			if !(math.Abs(value) <= maxOSCDelta) {
+				return fmt.Errorf("delta %g out of range (-%d to %d)", value, maxOSCDelta, maxOSCDelta)
+			}
+			ev.Delta = int(math.Round(value))
+			ev.Raw = ev.Delta
+			if ev.Delta == 0 {
+				return nil
+			}
+		} else {
+			if !(value >= 0 && value <= 1) {
+				return fmt.Errorf("value %g out of range (0-1)", value)
+			}
+			ev.Value = value
+		}
+
+		controlmapping.PublishInput(ev)
+		// Send to the mapping engine (non-blocking)
+		select {
+		case eventChan <- ev:
+		default:
+			log.Println("Warning: Event channel full, dropping OSC control event")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown address")
+}
+
+// maxOSCDelta is the largest encoder movement per message, as much as a module sends in one frame.
+const maxOSCDelta = 127
+
+func parseControl(module, control string) (uint8, uint8, error) {
+	moduleID, err := strconv.ParseUint(module, 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid module ID '%s'", module)
+	}
+	controlID, err := strconv.ParseUint(control, 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid control ID '%s'", control)
+	}
+	return uint8(moduleID), uint8(controlID), nil
+}
+
+// numberArg returns the single numeric argument of a message.
+func numberArg(m oscprotocol.Message) (float64, error) {
+	if len(m.Args) != 1 {
+		return 0, fmt.Errorf("expected one value, got %d arguments", len(m.Args))
+	}
+	switch v := m.Args[0].(type) {
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", m.Args[0])
+}
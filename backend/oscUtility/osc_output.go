@@ -0,0 +1,143 @@
+package oscUtility
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	oscprotocol "modularMidiGoApp/backend/oscUtility/oscProtocol"
+)
+
+// DefaultAddress is the address template used when none is configured.
+const DefaultAddress = "/module/{module}/{kind}/{control}"
+
+// ControlKey identifies a control by module ID and control ID.
+type ControlKey struct {
+	Module  uint8
+	Control uint8
+}
+
+// OutputConfig is the [osc_output] section of modularMidi.conf.
+type OutputConfig struct {
+	Targets []string // host:port of every receiver
+	// Address of a control. {module} and {control} are replaced by the IDs, {kind} by the
+	// kind the module described the control as, or "control" if it didn't
+	Address   string
+	Addresses map[ControlKey]string // Per control addresses, used instead of Address
+}
+
+// Validate checks the targets and addresses.
+func (c OutputConfig) Validate() error {
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("no OSC targets")
+	}
+	for _, target := range c.Targets {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("invalid OSC target '%s': %w", target, err)
+		}
+	}
+	if !strings.HasPrefix(c.Address, "/") {
+		return fmt.Errorf("OSC address '%s' must start with '/'", c.Address)
+	}
+	for key, address := range c.Addresses {
+		if !strings.HasPrefix(address, "/") {
+			return fmt.Errorf("OSC address '%s' of module %d control %d must start with '/'", address, key.Module, key.Control)
+		}
+	}
+	return nil
+}
+
+// oscTarget is one receiver. Failures are logged once until sending works again.
+type oscTarget struct {
+	address string
+	conn    *net.UDPConn
+	failing bool
+}
+
+// OSCSender sends the value of every control as OSC message with a float argument to
+// the configured targets, next to the MIDI output. Relative encoders send their
+// movement as int argument instead.
+func OSCSender(conf OutputConfig, stopChan <-chan struct{}) {
+	var targets []*oscTarget
+	for _, address := range conf.Targets {
+		addr, err := net.ResolveUDPAddr("udp", address)
+		if err != nil {
+			log.Printf("Failed to resolve OSC target %s: %v", address, err)
+			continue
+		}
+		conn, err := net.DialUDP("udp", nil, addr)
+		if err != nil {
+			log.Printf("Failed to open OSC target %s: %v", address, err)
+			continue
+		}
+		defer conn.Close()
+		targets = append(targets, &oscTarget{address: address, conn: conn})
+	}
+	if len(targets) == 0 {
+		log.Println("No OSC targets available, OSC output disabled")
+		return
+	}
+	log.Printf("Sending OSC to %s", strings.Join(conf.Targets, ", "))
+
+	events, cancel := controlmapping.SubscribeValues()
+	defer cancel()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		case ev := <-events:
+			msg := oscprotocol.Message{Address: conf.address(ev.ModuleID, ev.ControlID)}
+			if ev.Delta != 0 {
+				msg.Args = []any{int32(ev.Delta)}
+			} else {
+				msg.Args = []any{float32(ev.Value)}
+			}
+			data, err := oscprotocol.Encode(msg)
+			if err != nil {
+				log.Printf("Failed to encode OSC message: %v", err)
+				continue
+			}
+			for _, t := range targets {
+				t.send(data)
+			}
+		}
+	}
+}
+
+func (t *oscTarget) send(data []byte) {
+	_, err := t.conn.Write(data)
+	if err != nil && !t.failing {
+		log.Printf("Failed to send OSC to %s: %v", t.address, err)
+	}
+	t.failing = err != nil
+}
+
+// address returns the OSC address of a control.
+func (c OutputConfig) address(module, control uint8) string {
+	if address, ok := c.Addresses[ControlKey{module, control}]; ok {
+		return address
+	}
+	return strings.NewReplacer(
+		"{module}", strconv.Itoa(int(module)),
+		"{control}", strconv.Itoa(int(control)),
+		"{kind}", controlKind(module, control),
+	).Replace(c.Address)
+}
+
+// controlKind returns the kind of a control from the descriptor of its module.
+func controlKind(module, control uint8) string {
+	m, ok := moduleregistry.Lookup(module)
+	if ok && m.Descriptor != nil {
+		for _, c := range m.Descriptor.Controls {
+			if c.ID == control {
+				return c.Kind.String()
+			}
+		}
+	}
+	return "control"
+}
@@ -0,0 +1,209 @@
+package udpUtility
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	usbUtility "modularMidiGoApp/backend/usbUtility"
+	serialprotocol "modularMidiGoApp/backend/usbUtility/serialProtocol"
+)
+
+// senderTimeout is how long a sender may stay silent before it is forgotten.
+const senderTimeout = 5 * time.Minute
+
+// SenderInfo describes one ESP32 that sent frames to the backend.
+type SenderInfo struct {
+	Address  string               `json:"address"`
+	LastSeen time.Time            `json:"last_seen"`
+	Stats    serialprotocol.Stats `json:"stats"`
+}
+
+type sender struct {
+	decoder  *serialprotocol.Decoder
+	lastSeen time.Time
+}
+
+var (
+	sendersMu sync.Mutex
+	senders   = make(map[string]*sender)
+)
+
+// UDPMidiListener receives frames from any number of modules on the given port and
+// feeds them into the same processing as the serial listener. Frames for the modules
+// are sent to devicePort on the host they were received from.
+func UDPMidiListener(port string, devicePort string, inputRange usbUtility.ValueRange, eventChan chan<- controlmapping.ControlEvent, stopChan <-chan struct{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("UDPMidiListener recovered from panic: %v", r)
+		}
+	}()
+
+	for {
+		select {
+		case <-stopChan:
+			log.Println("UDPMidiListener stopping...")
+			return
+		default:
+			if err := listenUDP(port, devicePort, inputRange, eventChan, stopChan); err != nil {
+				log.Printf("UDP listener error: %v", err)
+				log.Println("Retrying in 5 seconds...")
+
+				select {
+				case <-time.After(5 * time.Second):
+					continue
+				case <-stopChan:
+					return
+				}
+			}
+		}
+	}
+}
+
+func listenUDP(port string, devicePort string, inputRange usbUtility.ValueRange, eventChan chan<- controlmapping.ControlEvent, stopChan <-chan struct{}) error {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%s", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on UDP port %s: %w", port, err)
+	}
+	defer conn.Close()
+	defer forgetSenders()
+
+	log.Printf("Listening for modules on UDP port %s", port)
+
+	// Close the socket on stop so ReadFrom returns, and forget senders that went silent
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(senderTimeout / 10)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopChan:
+				conn.Close()
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				pruneSenders("")
+			}
+		}
+	}()
+
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-stopChan:
+				log.Println("Stopping UDP listener...")
+				return nil
+			default:
+			}
+			return fmt.Errorf("failed to read from UDP socket: %w", err)
+		}
+
+		decoder, isNew := decoderFor(addr.String())
+		if isNew {
+			moduleregistry.SetWriter("udp:"+addr.String(), &deviceWriter{conn: conn, addr: deviceAddr(addr, devicePort)})
+		}
+		for _, frame := range decoder.Feed(buf[:n]) {
+			if err := usbUtility.ProcessFrame(frame, "udp:"+addr.String(), inputRange, eventChan); err != nil {
+				log.Printf("Error processing frame from %s (module %d): %v", addr, frame.ModuleID, err)
+			}
+		}
+	}
+}
+
+// decoderFor returns the decoder of a sender, so interleaved datagrams of
+// several modules never end up in the same buffer. isNew is set for unknown senders.
+func decoderFor(address string) (decoder *serialprotocol.Decoder, isNew bool) {
+	sendersMu.Lock()
+	defer sendersMu.Unlock()
+
+	now := time.Now()
+	s, ok := senders[address]
+	if !ok {
+		log.Printf("New UDP sender: %s", address)
+		s = &sender{decoder: serialprotocol.NewDecoder(), lastSeen: now}
+		senders[address] = s
+		pruneLocked(now, address)
+	}
+	s.lastSeen = now
+	return s.decoder, !ok
+}
+
+// pruneSenders forgets senders that were silent for longer than senderTimeout, except keep.
+func pruneSenders(keep string) {
+	sendersMu.Lock()
+	defer sendersMu.Unlock()
+	pruneLocked(time.Now(), keep)
+}
+
+// pruneLocked must be called with sendersMu held.
+func pruneLocked(now time.Time, keep string) {
+	for addr, other := range senders {
+		if now.Sub(other.lastSeen) > senderTimeout && addr != keep {
+			log.Printf("Forgetting silent UDP sender: %s", addr)
+			delete(senders, addr)
+			moduleregistry.SourceLost("udp:" + addr)
+		}
+	}
+}
+
+// forgetSenders drops all senders once the socket is closed, their modules can't be
+// reached through it anymore.
+func forgetSenders() {
+	sendersMu.Lock()
+	defer sendersMu.Unlock()
+
+	for addr := range senders {
+		delete(senders, addr)
+		moduleregistry.SourceLost("udp:" + addr)
+	}
+}
+
+// deviceWriter sends frames to the port a module listens on.
+type deviceWriter struct {
+	conn net.PacketConn
+	addr net.Addr
+}
+
+func (w *deviceWriter) Write(data []byte) (int, error) {
+	return w.conn.WriteTo(data, w.addr)
+}
+
+// deviceAddr replaces the port frames were sent from with the port the module listens on.
+func deviceAddr(from net.Addr, devicePort string) net.Addr {
+	udpAddr, ok := from.(*net.UDPAddr)
+	if !ok {
+		return from
+	}
+	port, err := strconv.Atoi(devicePort)
+	if err != nil {
+		return from
+	}
+	return &net.UDPAddr{IP: udpAddr.IP, Port: port, Zone: udpAddr.Zone}
+}
+
+// Senders lists the modules that sent frames recently, sorted by address.
+func Senders() []SenderInfo {
+	sendersMu.Lock()
+	defer sendersMu.Unlock()
+
+	list := make([]SenderInfo, 0, len(senders))
+	for addr, s := range senders {
+		list = append(list, SenderInfo{
+			Address:  addr,
+			LastSeen: s.lastSeen,
+			Stats:    s.decoder.Stats(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list
+}
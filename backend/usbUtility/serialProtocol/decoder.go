@@ -0,0 +1,148 @@
+package serialprotocol
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats counts what the decoder has seen so far. Counters are never reset.
+type Stats struct {
+	Frames         uint64 `json:"frames"`
+	ChecksumErrors uint64 `json:"checksum_errors"`
+	DiscardedBytes uint64 `json:"discarded_bytes"`
+	MalformedRelay uint64 `json:"malformed_relay"`
+}
+
+// Decoder turns a byte stream into frames. It is safe to read Stats while another
+// goroutine is feeding data.
+type Decoder struct {
+	mu  sync.Mutex
+	buf []byte
+
+	frames         atomic.Uint64
+	checksumErrors atomic.Uint64
+	discardedBytes atomic.Uint64
+	malformedRelay atomic.Uint64
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Feed appends data to the internal buffer and returns every complete frame found.
+// Incomplete frames stay buffered until the next call.
+func (d *Decoder) Feed(data []byte) []Frame {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.buf = append(d.buf, data...)
+	var frames []Frame
+
+	for {
+		// Skip garbage in front of the next start byte
+		start := bytes.IndexByte(d.buf, StartByte)
+		if start == -1 {
+			d.discard(len(d.buf))
+			break
+		}
+		d.discard(start)
+
+		frameLength, complete, valid := checkFrame(d.buf)
+		if !complete {
+			// A garbage start byte with a large length field would stall the stream,
+			// so give up on it as soon as a valid frame shows up behind it.
+			if next := nextValidFrame(d.buf); next > 0 {
+				d.checksumErrors.Add(1)
+				d.discard(next)
+				continue
+			}
+			break
+		}
+		if !valid {
+			// Either corrupted or a start byte that was part of a payload,
+			// drop it and look for the next one.
+			d.checksumErrors.Add(1)
+			d.discard(1)
+			continue
+		}
+
+		payloadLength := frameLength - headerLength - 1
+		payload := make([]byte, payloadLength)
+		copy(payload, d.buf[headerLength:frameLength-1])
+		frame := Frame{
+			ModuleID: d.buf[1],
+			Type:     MessageType(d.buf[2]),
+			Payload:  payload,
+		}
+		d.buf = d.buf[frameLength:]
+
+		if frame.Type == MsgRelay {
+			inner, err := unwrapRelay(frame)
+			if err != nil {
+				d.malformedRelay.Add(1)
+				continue
+			}
+			frame = inner
+		}
+		frames = append(frames, frame)
+		d.frames.Add(1)
+	}
+
+	// Don't keep the old backing array alive forever
+	if len(d.buf) == 0 {
+		d.buf = nil
+	}
+	return frames
+}
+
+// Flush drops a partially received frame, e.g. after reconnecting or at the end of a datagram.
+func (d *Decoder) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.discard(len(d.buf))
+	d.buf = nil
+}
+
+// Stats returns a snapshot of the counters.
+func (d *Decoder) Stats() Stats {
+	return Stats{
+		Frames:         d.frames.Load(),
+		ChecksumErrors: d.checksumErrors.Load(),
+		DiscardedBytes: d.discardedBytes.Load(),
+		MalformedRelay: d.malformedRelay.Load(),
+	}
+}
+
+// checkFrame looks at a frame starting at buf[0]. complete is false while more bytes are needed.
+func checkFrame(buf []byte) (frameLength int, complete bool, valid bool) {
+	if len(buf) < headerLength {
+		return 0, false, false
+	}
+	frameLength = headerLength + int(buf[3]) + 1
+	if len(buf) < frameLength {
+		return frameLength, false, false
+	}
+	return frameLength, true, CRC8(buf[1:frameLength-1]) == buf[frameLength-1]
+}
+
+// nextValidFrame returns the offset of the first complete, valid frame after buf[0], or -1.
+func nextValidFrame(buf []byte) int {
+	for i := 1; i < len(buf); i++ {
+		if buf[i] != StartByte {
+			continue
+		}
+		if _, complete, valid := checkFrame(buf[i:]); complete && valid {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Decoder) discard(n int) {
+	if n <= 0 {
+		return
+	}
+	d.discardedBytes.Add(uint64(n))
+	d.buf = d.buf[n:]
+}
@@ -0,0 +1,133 @@
+package serialprotocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mustEncode(t *testing.T, f Frame) []byte {
+	t.Helper()
+	b, err := Encode(f)
+	if err != nil {
+		t.Fatalf("Encode(%+v): %v", f, err)
+	}
+	return b
+}
+
+func concat(chunks ...[]byte) []byte {
+	var out []byte
+	for _, c := range chunks {
+		out = append(out, c...)
+	}
+	return out
+}
+
+func TestDecoderRoundTrip(t *testing.T) {
+	values := Frame{ModuleID: 3, Type: MsgControlValue, Payload: ControlValuePayload(ControlValue{Control: 1, Value: 4095})}
+	heartbeat := Frame{ModuleID: 7, Type: MsgHeartbeat, Payload: []byte{}}
+	relayed := Frame{ModuleID: 9, Type: MsgControlDelta, Payload: ControlDeltaPayload(ControlDelta{Control: 2, Delta: -3}), HopPath: []uint8{4, 1}}
+
+	// A payload containing the start byte, so a naive resync would stop inside it
+	startInPayload := Frame{ModuleID: 2, Type: MsgControlChange, Payload: ControlChangePayload([2]uint8{StartByte, 0x10})}
+
+	// A bad checksum, the last byte flipped
+	corrupted := mustEncode(t, values)
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	// A frame whose length field promises more than ever arrives
+	truncated := mustEncode(t, Frame{ModuleID: 5, Type: MsgControlValue, Payload: make([]byte, 12)})[:8]
+
+	tests := []struct {
+		name   string
+		chunks [][]byte // Fed one after another
+		want   []Frame
+		stats  Stats
+	}{
+		{
+			name:   "single frame",
+			chunks: [][]byte{mustEncode(t, values)},
+			want:   []Frame{values},
+			stats:  Stats{Frames: 1},
+		},
+		{
+			name:   "relayed frame",
+			chunks: [][]byte{mustEncode(t, relayed)},
+			want:   []Frame{relayed},
+			stats:  Stats{Frames: 1},
+		},
+		{
+			name:   "resync after garbage",
+			chunks: [][]byte{concat([]byte{0x00, 0x13, 0x37}, mustEncode(t, values), []byte{0xFF}, mustEncode(t, heartbeat))},
+			want:   []Frame{values, heartbeat},
+			stats:  Stats{Frames: 2, DiscardedBytes: 4},
+		},
+		{
+			name:   "start byte in payload",
+			chunks: [][]byte{concat([]byte{0x42}, mustEncode(t, startInPayload))},
+			want:   []Frame{startInPayload},
+			stats:  Stats{Frames: 1, DiscardedBytes: 1},
+		},
+		{
+			name:   "bad checksum counted and skipped",
+			chunks: [][]byte{concat(corrupted, mustEncode(t, heartbeat))},
+			want:   []Frame{heartbeat},
+			stats:  Stats{Frames: 1, ChecksumErrors: 1, DiscardedBytes: uint64(len(corrupted))},
+		},
+		{
+			name:   "frame split across reads",
+			chunks: [][]byte{mustEncode(t, values)[:3], mustEncode(t, values)[3:]},
+			want:   []Frame{values},
+			stats:  Stats{Frames: 1},
+		},
+		{
+			name:   "truncated frame followed by a valid one",
+			chunks: [][]byte{truncated, mustEncode(t, heartbeat)},
+			want:   []Frame{heartbeat},
+			stats:  Stats{Frames: 1, ChecksumErrors: 1, DiscardedBytes: uint64(len(truncated))},
+		},
+		{
+			name:   "truncated frame waits for more data",
+			chunks: [][]byte{truncated},
+			want:   nil,
+			stats:  Stats{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder()
+			var got []Frame
+			for _, chunk := range tt.chunks {
+				got = append(got, d.Feed(chunk)...)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("frames = %+v, want %+v", got, tt.want)
+			}
+			if stats := d.Stats(); stats != tt.stats {
+				t.Errorf("stats = %+v, want %+v", stats, tt.stats)
+			}
+		})
+	}
+}
+
+func TestDecoderFlushDropsTruncatedFrame(t *testing.T) {
+	d := NewDecoder()
+	frame := mustEncode(t, Frame{ModuleID: 1, Type: MsgHeartbeat, Payload: []byte{}})
+
+	if got := d.Feed(frame[:2]); len(got) != 0 {
+		t.Fatalf("got %d frames from half a frame", len(got))
+	}
+	d.Flush()
+	if got := d.Feed(frame[2:]); len(got) != 0 {
+		t.Fatalf("got %d frames from the rest after Flush", len(got))
+	}
+	if stats := d.Stats(); stats.DiscardedBytes != uint64(len(frame)) {
+		t.Errorf("discarded %d bytes, want %d", stats.DiscardedBytes, len(frame))
+	}
+}
+
+func TestEncodeRejectsLongPayload(t *testing.T) {
+	if _, err := Encode(Frame{ModuleID: 1, Type: MsgDescriptor, Payload: make([]byte, MaxPayloadLength+1)}); err == nil {
+		t.Error("expected an error for a payload over MaxPayloadLength")
+	}
+}
@@ -0,0 +1,105 @@
+package serialprotocol
+
+import "fmt"
+
+// A MsgDescriptor payload looks like this:
+//
+//	| type length | module type ... | firmware major | minor | patch | control count | controls ... |
+//
+// with every control taking three bytes: | control ID | kind | resolution in bits |.
+
+// ControlKind tells what kind of hardware a control is.
+type ControlKind uint8
+
+const (
+	KindFader   ControlKind = 0x01
+	KindKnob    ControlKind = 0x02
+	KindEncoder ControlKind = 0x03
+	KindButton  ControlKind = 0x04
+)
+
+func (k ControlKind) String() string {
+	switch k {
+	case KindFader:
+		return "fader"
+	case KindKnob:
+		return "knob"
+	case KindEncoder:
+		return "encoder"
+	case KindButton:
+		return "button"
+	}
+	return fmt.Sprintf("unknown(0x%02X)", uint8(k))
+}
+
+// MarshalText lets descriptors show the kind by name in the HTTP API.
+func (k ControlKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ControlDescriptor describes one control of a module.
+type ControlDescriptor struct {
+	ID         uint8       `json:"id"`
+	Kind       ControlKind `json:"kind"`
+	Resolution uint8       `json:"resolution"` // Bits, e.g. 12 for the ESP32 ADC and 1 for buttons
+}
+
+// Descriptor is what a module reports about itself in a MsgDescriptor frame.
+type Descriptor struct {
+	ModuleType string              `json:"module_type"`
+	Firmware   string              `json:"firmware"` // major.minor.patch
+	Controls   []ControlDescriptor `json:"controls"`
+}
+
+// ParseDescriptor decodes the payload of a MsgDescriptor frame.
+func ParseDescriptor(payload []byte) (Descriptor, error) {
+	if len(payload) < 1 {
+		return Descriptor{}, fmt.Errorf("empty descriptor payload")
+	}
+	typeLength := int(payload[0])
+	if len(payload) < 1+typeLength+4 {
+		return Descriptor{}, fmt.Errorf("descriptor payload too short: %d bytes", len(payload))
+	}
+	d := Descriptor{ModuleType: string(payload[1 : 1+typeLength])}
+
+	p := payload[1+typeLength:]
+	d.Firmware = fmt.Sprintf("%d.%d.%d", p[0], p[1], p[2])
+
+	count := int(p[3])
+	controls := p[4:]
+	if len(controls) != count*3 {
+		return Descriptor{}, fmt.Errorf("descriptor lists %d controls but carries %d bytes", count, len(controls))
+	}
+	d.Controls = make([]ControlDescriptor, 0, count)
+	for i := 0; i < len(controls); i += 3 {
+		d.Controls = append(d.Controls, ControlDescriptor{
+			ID:         controls[i],
+			Kind:       ControlKind(controls[i+1]),
+			Resolution: controls[i+2],
+		})
+	}
+	return d, nil
+}
+
+// DescriptorPayload builds the payload of a MsgDescriptor frame.
+func DescriptorPayload(d Descriptor) ([]byte, error) {
+	var major, minor, patch uint8
+	if _, err := fmt.Sscanf(d.Firmware, "%d.%d.%d", &major, &minor, &patch); err != nil {
+		return nil, fmt.Errorf("invalid firmware version %q: %w", d.Firmware, err)
+	}
+	if len(d.ModuleType) > 255 || len(d.Controls) > 255 {
+		return nil, fmt.Errorf("module type or control list too long")
+	}
+
+	payload := make([]byte, 0, 5+len(d.ModuleType)+len(d.Controls)*3)
+	payload = append(payload, byte(len(d.ModuleType)))
+	payload = append(payload, d.ModuleType...)
+	payload = append(payload, major, minor, patch, byte(len(d.Controls)))
+	for _, c := range d.Controls {
+		payload = append(payload, c.ID, byte(c.Kind), c.Resolution)
+	}
+	if len(payload) > MaxPayloadLength {
+		return nil, fmt.Errorf("descriptor too long: %d bytes (max %d)", len(payload), MaxPayloadLength)
+	}
+	return payload, nil
+}
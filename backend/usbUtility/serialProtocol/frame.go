@@ -0,0 +1,195 @@
+// Package serialprotocol implements the framed binary protocol spoken between the
+// modules and the backend, over USB serial as well as over UDP.
+//
+// Every frame looks like this:
+//
+//	| 0xA5 | module ID | message type | payload length | payload ... | CRC8 |
+//
+// The CRC8 (polynomial 0x07) covers module ID, message type, payload length and payload.
+// Since the start byte may also show up inside a payload, the decoder only accepts a
+// frame once the checksum matches and otherwise resynchronises on the next start byte.
+//
+// Expansion modules reach the backend through other modules. Every module that passes
+// a frame on wraps it in a MsgRelay frame, see relay.go.
+package serialprotocol
+
+import "fmt"
+
+// StartByte marks the beginning of every frame.
+const StartByte byte = 0xA5
+
+// MaxPayloadLength is the largest payload the one byte length field can describe.
+const MaxPayloadLength = 255
+
+// headerLength is start byte, module ID, message type and payload length.
+const headerLength = 4
+
+// MessageType tells the backend how to interpret the payload of a frame.
+type MessageType uint8
+
+const (
+	// MsgControlChange carries (controller, value) pairs with 7-bit values.
+	MsgControlChange MessageType = 0x01
+	// MsgControlValue carries (control, value high byte, value low byte) triplets with
+	// raw ADC values, e.g. 0-4095 from the ESP32.
+	MsgControlValue MessageType = 0x02
+	// MsgModuleJoin is sent by a module once it is attached, empty payload.
+	MsgModuleJoin MessageType = 0x03
+	// MsgModuleLeave is sent by a module when a neighbour was detached, payload is the ID
+	// of the detached module.
+	MsgModuleLeave MessageType = 0x04
+	// MsgHeartbeat is sent by every module about once a second, empty payload.
+	MsgHeartbeat MessageType = 0x05
+	// MsgDescriptor describes a module and its controls, see descriptor.go.
+	MsgDescriptor MessageType = 0x06
+	// MsgDescriptorRequest is sent by the backend to a module that hasn't described
+	// itself yet, empty payload.
+	MsgDescriptorRequest MessageType = 0x07
+	// MsgFeedback is sent by the backend to set LEDs or motorised faders, with the same
+	// triplets as MsgControlValue but 14-bit values (0-16383).
+	MsgFeedback MessageType = 0x08
+	// MsgControlDelta carries (control, delta) pairs from rotary encoders, with the
+	// detents turned since the last frame as signed byte, positive clockwise.
+	MsgControlDelta MessageType = 0x09
+	// MsgRelay wraps a frame of another module, see relay.go.
+	MsgRelay MessageType = 0x10
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgControlChange:
+		return "control_change"
+	case MsgControlValue:
+		return "control_value"
+	case MsgModuleJoin:
+		return "module_join"
+	case MsgModuleLeave:
+		return "module_leave"
+	case MsgHeartbeat:
+		return "heartbeat"
+	case MsgDescriptor:
+		return "descriptor"
+	case MsgDescriptorRequest:
+		return "descriptor_request"
+	case MsgFeedback:
+		return "feedback"
+	case MsgControlDelta:
+		return "control_delta"
+	case MsgRelay:
+		return "relay"
+	}
+	return fmt.Sprintf("unknown(0x%02X)", uint8(t))
+}
+
+// Frame is one decoded message from a module, or a message for a module.
+type Frame struct {
+	ModuleID uint8 // Module the frame originates from, or is addressed to
+	Type     MessageType
+	Payload  []byte
+	// HopPath lists the modules that relayed the frame, starting next to the source
+	// and ending with the module connected to the PC. Empty for frames of that module.
+	// Frames for a module use the same path, the PC side module forwards them backwards.
+	HopPath []uint8
+}
+
+// Encode serialises a frame including start byte and checksum.
+// Frames with a HopPath are wrapped into a MsgRelay frame.
+func Encode(f Frame) ([]byte, error) {
+	if len(f.HopPath) > 0 {
+		relay, err := wrapRelay(f)
+		if err != nil {
+			return nil, err
+		}
+		f = relay
+	}
+	if len(f.Payload) > MaxPayloadLength {
+		return nil, fmt.Errorf("payload too long: %d bytes (max %d)", len(f.Payload), MaxPayloadLength)
+	}
+	out := make([]byte, 0, headerLength+len(f.Payload)+1)
+	out = append(out, StartByte, f.ModuleID, byte(f.Type), byte(len(f.Payload)))
+	out = append(out, f.Payload...)
+	out = append(out, CRC8(out[1:]))
+	return out, nil
+}
+
+// CRC8 computes the checksum (polynomial 0x07, initial value 0x00) used by the frames.
+func CRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// ControlChangePayload builds the payload of a MsgControlChange frame from (controller, value) pairs.
+func ControlChangePayload(pairs ...[2]uint8) []byte {
+	payload := make([]byte, 0, len(pairs)*2)
+	for _, pair := range pairs {
+		payload = append(payload, pair[0], pair[1])
+	}
+	return payload
+}
+
+// ControlValue is one raw reading of a control, or one feedback value.
+type ControlValue struct {
+	Control uint8
+	Value   uint16
+}
+
+// ControlValuePayload builds the payload of a MsgControlValue or MsgFeedback frame.
+func ControlValuePayload(values ...ControlValue) []byte {
+	payload := make([]byte, 0, len(values)*3)
+	for _, v := range values {
+		payload = append(payload, v.Control, byte(v.Value>>8), byte(v.Value))
+	}
+	return payload
+}
+
+// ParseControlValues decodes the payload of a MsgControlValue frame.
+func ParseControlValues(payload []byte) ([]ControlValue, error) {
+	if len(payload) == 0 || len(payload)%3 != 0 {
+		return nil, fmt.Errorf("invalid control value payload length: %d bytes", len(payload))
+	}
+	values := make([]ControlValue, 0, len(payload)/3)
+	for i := 0; i < len(payload); i += 3 {
+		values = append(values, ControlValue{
+			Control: payload[i],
+			Value:   uint16(payload[i+1])<<8 | uint16(payload[i+2]),
+		})
+	}
+	return values, nil
+}
+
+// ControlDelta is the movement of an encoder since its last frame.
+type ControlDelta struct {
+	Control uint8
+	Delta   int8
+}
+
+// ControlDeltaPayload builds the payload of a MsgControlDelta frame.
+func ControlDeltaPayload(deltas ...ControlDelta) []byte {
+	payload := make([]byte, 0, len(deltas)*2)
+	for _, d := range deltas {
+		payload = append(payload, d.Control, byte(d.Delta))
+	}
+	return payload
+}
+
+// ParseControlDeltas decodes the payload of a MsgControlDelta frame.
+func ParseControlDeltas(payload []byte) ([]ControlDelta, error) {
+	if len(payload) == 0 || len(payload)%2 != 0 {
+		return nil, fmt.Errorf("invalid control delta payload length: %d bytes", len(payload))
+	}
+	deltas := make([]ControlDelta, 0, len(payload)/2)
+	for i := 0; i < len(payload); i += 2 {
+		deltas = append(deltas, ControlDelta{Control: payload[i], Delta: int8(payload[i+1])})
+	}
+	return deltas, nil
+}
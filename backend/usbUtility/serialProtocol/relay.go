@@ -0,0 +1,61 @@
+package serialprotocol
+
+import "fmt"
+
+// A relayed frame is sent by the module connected to the PC (the last hop) as:
+//
+//	| 0xA5 | last hop ID | MsgRelay | length | source ID | hop count | hops ... | type | payload ... | CRC8 |
+//
+// A module relaying a frame that is already wrapped appends its own ID to the hops
+// and bumps the hop count instead of wrapping it a second time.
+//
+// Frames from the backend to an expansion module use the same layout with the
+// destination in place of the source ID. Every module passes them on to the hop
+// before its own ID until the destination is reached.
+
+// wrapRelay builds the MsgRelay frame for a frame with a HopPath.
+func wrapRelay(f Frame) (Frame, error) {
+	if f.Type == MsgRelay {
+		return Frame{}, fmt.Errorf("relay frames cannot be relayed again")
+	}
+	payload := make([]byte, 0, 3+len(f.HopPath)+len(f.Payload))
+	payload = append(payload, f.ModuleID, byte(len(f.HopPath)))
+	payload = append(payload, f.HopPath...)
+	payload = append(payload, byte(f.Type))
+	payload = append(payload, f.Payload...)
+
+	if len(payload) > MaxPayloadLength {
+		return Frame{}, fmt.Errorf("relayed payload too long: %d bytes (max %d)", len(payload), MaxPayloadLength)
+	}
+	return Frame{
+		ModuleID: f.HopPath[len(f.HopPath)-1],
+		Type:     MsgRelay,
+		Payload:  payload,
+	}, nil
+}
+
+// unwrapRelay restores the original frame from a MsgRelay frame.
+func unwrapRelay(relay Frame) (Frame, error) {
+	p := relay.Payload
+	if len(p) < 3 {
+		return Frame{}, fmt.Errorf("relay payload too short: %d bytes", len(p))
+	}
+	hopCount := int(p[1])
+	if hopCount == 0 || len(p) < 3+hopCount {
+		return Frame{}, fmt.Errorf("relay payload of %d bytes too short for %d hops", len(p), hopCount)
+	}
+	hops := append([]uint8{}, p[2:2+hopCount]...)
+	if hops[len(hops)-1] != relay.ModuleID {
+		return Frame{}, fmt.Errorf("relay from module %d does not end its hop path", relay.ModuleID)
+	}
+	innerType := MessageType(p[2+hopCount])
+	if innerType == MsgRelay {
+		return Frame{}, fmt.Errorf("nested relay frame")
+	}
+	return Frame{
+		ModuleID: p[0],
+		Type:     innerType,
+		Payload:  append([]byte{}, p[3+hopCount:]...),
+		HopPath:  hops,
+	}, nil
+}
@@ -1,14 +1,17 @@
 package usbUtility
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
-	midiOutputPipeline "modularMidiGoApp/backend/midiUtility/midiOutputPipeline"
+	controlmapping "modularMidiGoApp/backend/controlMapping"
+	moduleregistry "modularMidiGoApp/backend/moduleRegistry"
+	serialprotocol "modularMidiGoApp/backend/usbUtility/serialProtocol"
 
 	"go.bug.st/serial"
 )
@@ -19,7 +22,61 @@ type USBPortsList struct {
 	SelectedUSBDevice   string      `json:"selected_usb_device"`
 }
 
-func ESP32MidiListener(channel uint8, outputChan chan<- midiOutputPipeline.MidiCCMessage, stopChan <-chan struct{}) {
+// SerialConfig holds the serial port settings read from the [serial] section of modularMidi.conf.
+type SerialConfig struct {
+	BaudRate              int
+	DataBits              int
+	Parity                serial.Parity
+	StopBits              serial.StopBits
+	SelectionPollInterval time.Duration // How often usb_ports.json is checked for a new selection
+}
+
+// DefaultSerialConfig matches the settings used by the ESP32 sketch.
+var DefaultSerialConfig = SerialConfig{
+	BaudRate:              115200,
+	DataBits:              8,
+	Parity:                serial.NoParity,
+	StopBits:              serial.OneStopBit,
+	SelectionPollInterval: time.Second,
+}
+
+// serialDecoder keeps its counters across reconnects so they can be reported over HTTP.
+var serialDecoder = serialprotocol.NewDecoder()
+
+// errSelectionChanged is returned by listenToESP32 when another device was selected in usb_ports.json.
+var errSelectionChanged = errors.New("selected USB device changed")
+
+// ParseParity converts a parity name from the config file (none, odd, even, mark, space).
+func ParseParity(name string) (serial.Parity, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none", "n":
+		return serial.NoParity, nil
+	case "odd", "o":
+		return serial.OddParity, nil
+	case "even", "e":
+		return serial.EvenParity, nil
+	case "mark", "m":
+		return serial.MarkParity, nil
+	case "space", "s":
+		return serial.SpaceParity, nil
+	}
+	return serial.NoParity, fmt.Errorf("unknown parity '%s'", name)
+}
+
+// ParseStopBits converts a stop bit setting from the config file (1, 1.5, 2).
+func ParseStopBits(value string) (serial.StopBits, error) {
+	switch strings.TrimSpace(value) {
+	case "", "1":
+		return serial.OneStopBit, nil
+	case "1.5":
+		return serial.OnePointFiveStopBits, nil
+	case "2":
+		return serial.TwoStopBits, nil
+	}
+	return serial.OneStopBit, fmt.Errorf("unknown stop bits '%s'", value)
+}
+
+func ESP32MidiListener(inputRange ValueRange, conf SerialConfig, eventChan chan<- controlmapping.ControlEvent, stopChan <-chan struct{}) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("ESP32MidiListener recovered from panic: %v", r)
@@ -32,7 +89,12 @@ func ESP32MidiListener(channel uint8, outputChan chan<- midiOutputPipeline.MidiC
 			log.Println("ESP32MidiListener stopping...")
 			return
 		default:
-			if err := listenToESP32(channel, outputChan, stopChan); err != nil {
+			err := listenToESP32(inputRange, conf, eventChan, stopChan)
+			if errors.Is(err, errSelectionChanged) {
+				log.Println("USB device selection changed, reconnecting...")
+				continue
+			}
+			if err != nil {
 				log.Printf("ESP32 connection error: %v", err)
 				log.Println("Retrying in 5 seconds...")
 
@@ -47,22 +109,23 @@ func ESP32MidiListener(channel uint8, outputChan chan<- midiOutputPipeline.MidiC
 	}
 }
 
-func listenToESP32(channel uint8, outputChan chan<- midiOutputPipeline.MidiCCMessage, stopChan <-chan struct{}) error {
+func listenToESP32(inputRange ValueRange, conf SerialConfig, eventChan chan<- controlmapping.ControlEvent, stopChan <-chan struct{}) error {
 	// Get the selected USB device
-	/*deviceName, err := getSelectedUSBDevice(FilePath)
+	deviceName, err := getSelectedUSBDevice(FilePath)
 	if err != nil {
 		return fmt.Errorf("failed to get USB device: %w", err)
 	}
-	*/
-	deviceName := "/dev/ttyUSB0" // Replace with your actual device path or logic to get it dynamically
+	if deviceName == "" {
+		return fmt.Errorf("no USB device selected in %s", FilePath)
+	}
 	log.Printf("Connecting to ESP32 on device: %s", deviceName)
 
 	// Configure serial port
 	mode := &serial.Mode{
-		BaudRate: 115200, // Adjust baud rate as needed for your ESP32
-		DataBits: 8,
-		Parity:   serial.NoParity,
-		StopBits: serial.OneStopBit,
+		BaudRate: conf.BaudRate,
+		DataBits: conf.DataBits,
+		Parity:   conf.Parity,
+		StopBits: conf.StopBits,
 	}
 
 	// Open serial port
@@ -71,11 +134,22 @@ func listenToESP32(channel uint8, outputChan chan<- midiOutputPipeline.MidiCCMes
 		return fmt.Errorf("failed to open serial port: %w", err)
 	}
 	defer port.Close()
+	// The modules can't be reached anymore once the connection is gone
+	defer moduleregistry.SourceLost("usb")
+	moduleregistry.SetWriter("usb", port)
 
 	log.Printf("Successfully connected to ESP32 on %s", deviceName)
 
-	// Create buffered reader for line-by-line reading
-	reader := bufio.NewReader(port)
+	// The watcher closes the port when the selection changes or the listener is stopped,
+	// which unblocks the read below.
+	changed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go watchSelectedUSBDevice(deviceName, conf.SelectionPollInterval, port, changed, stopChan, done)
+
+	// Drop whatever was left over from a previous connection
+	serialDecoder.Flush()
+	buf := make([]byte, 256)
 
 	for {
 		select {
@@ -83,63 +157,204 @@ func listenToESP32(channel uint8, outputChan chan<- midiOutputPipeline.MidiCCMes
 			log.Println("Stopping ESP32 listener...")
 			return nil
 		default:
-			// Read line (until newline)
-			line, err := reader.ReadBytes('\n')
+			n, err := port.Read(buf)
 			if err != nil {
-				// Check if it's a timeout error (normal when no data)
-				if err.Error() == "timeout" {
-					continue
+				select {
+				case <-changed:
+					return errSelectionChanged
+				case <-stopChan:
+					log.Println("Stopping ESP32 listener...")
+					return nil
+				default:
 				}
 				return fmt.Errorf("failed to read from serial port: %w", err)
 			}
-
-			// Process the received data
-			if err := processMidiData(line, channel, outputChan); err != nil {
-				log.Printf("Error processing MIDI data: %v", err)
+			if n == 0 {
+				// Read timeout, nothing received
 				continue
 			}
+
+			// Process every complete frame received so far
+			for _, frame := range serialDecoder.Feed(buf[:n]) {
+				if err := ProcessFrame(frame, "usb", inputRange, eventChan); err != nil {
+					log.Printf("Error processing frame from module %d: %v", frame.ModuleID, err)
+				}
+			}
 		}
 	}
 }
 
-func processMidiData(data []byte, channel uint8, outputChan chan<- midiOutputPipeline.MidiCCMessage) error {
-	// Remove newline characters
-	if len(data) > 0 && (data[len(data)-1] == '\n' || data[len(data)-1] == '\r') {
-		data = data[:len(data)-1]
+// ProtocolStats returns the frame counters of the serial connection.
+func ProtocolStats() serialprotocol.Stats {
+	return serialDecoder.Stats()
+}
+
+// ProcessFrame turns a decoded frame into control events. It is shared by all input transports.
+// Every frame also counts as a sign of life of the module that sent it.
+func ProcessFrame(frame serialprotocol.Frame, source string, inputRange ValueRange, eventChan chan<- controlmapping.ControlEvent) error {
+	if !moduleregistry.Seen(source, frame.ModuleID, frame.HopPath) {
+		return nil
+	}
+
+	err := processFrameType(frame, source, inputRange, eventChan)
+
+	// Modules describe themselves when they join, ask again if that got lost
+	if moduleregistry.NeedsDescriptor(source, frame.ModuleID) {
+		request := serialprotocol.Frame{
+			ModuleID: frame.ModuleID,
+			Type:     serialprotocol.MsgDescriptorRequest,
+			HopPath:  frame.HopPath,
+		}
+		if err := moduleregistry.SendFrame(source, request); err != nil {
+			log.Printf("Failed to request descriptor of module %d: %v", frame.ModuleID, err)
+		}
 	}
-	if len(data) > 0 && data[len(data)-1] == '\r' {
-		data = data[:len(data)-1]
+	return err
+}
+
+func processFrameType(frame serialprotocol.Frame, source string, inputRange ValueRange, eventChan chan<- controlmapping.ControlEvent) error {
+	switch frame.Type {
+	case serialprotocol.MsgModuleJoin, serialprotocol.MsgHeartbeat:
+		return nil
+	case serialprotocol.MsgModuleLeave:
+		// Sent by the module a detached expansion module was plugged into
+		if len(frame.Payload) != 1 {
+			return fmt.Errorf("invalid module leave payload length: %d bytes", len(frame.Payload))
+		}
+		moduleregistry.Leave(source, frame.Payload[0])
+		return nil
+	case serialprotocol.MsgDescriptor:
+		descriptor, err := serialprotocol.ParseDescriptor(frame.Payload)
+		if err != nil {
+			return err
+		}
+		moduleregistry.SetDescriptor(source, frame.ModuleID, descriptor)
+		return nil
+	case serialprotocol.MsgControlChange:
+		return processControlChange(frame, source, eventChan)
+	case serialprotocol.MsgControlValue:
+		return processControlValues(frame, source, inputRange, eventChan)
+	case serialprotocol.MsgControlDelta:
+		return processControlDeltas(frame, source, eventChan)
+	default:
+		return fmt.Errorf("unsupported message type %s", frame.Type)
 	}
+}
 
+// processControlChange handles the older 7-bit (control, value) pairs.
+func processControlChange(frame serialprotocol.Frame, source string, eventChan chan<- controlmapping.ControlEvent) error {
+	data := frame.Payload
 	// Check if we have valid data (must be even number of bytes, minimum 2)
 	if len(data) < 2 || len(data)%2 != 0 {
-		return fmt.Errorf("invalid data length: %d bytes", len(data))
+		return fmt.Errorf("invalid control change payload length: %d bytes", len(data))
 	}
 
-	// Process pairs of bytes (CC number, value)
+	// Process pairs of bytes (control, value)
 	for i := 0; i < len(data); i += 2 {
-		ccNumber := data[i]
+		control := data[i]
 		value := data[i+1]
 
-		msg := midiOutputPipeline.MidiCCMessage{
-			Channel:    channel,
-			Controller: uint8(ccNumber),
-			Value:      uint8(value),
+		if value > 127 {
+			log.Printf("Warning: ignoring out of range value %d of control %d", value, control)
+			continue
 		}
 
-		// Send to output channel (non-blocking)
-		select {
-		case outputChan <- msg:
-			log.Printf("MIDI CC: Channel=%d, Controller=%d, Value=%d",
-				msg.Channel, msg.Controller, msg.Value)
-		default:
-			log.Println("Warning: Output channel full, dropping MIDI message")
+		sendEvent(eventChan, controlmapping.ControlEvent{
+			ModuleID:  frame.ModuleID,
+			ControlID: control,
+			Value:     float64(value) / 127,
+			Raw:       int(value),
+			Source:    source,
+		})
+	}
+
+	return nil
+}
+
+// processControlValues scales raw readings from the input range of the transport.
+func processControlValues(frame serialprotocol.Frame, source string, inputRange ValueRange, eventChan chan<- controlmapping.ControlEvent) error {
+	values, err := serialprotocol.ParseControlValues(frame.Payload)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		sendEvent(eventChan, controlmapping.ControlEvent{
+			ModuleID:  frame.ModuleID,
+			ControlID: v.Control,
+			Value:     inputRange.Normalize(int(v.Value)),
+			Raw:       int(v.Value),
+			Source:    source,
+		})
+	}
+
+	return nil
+}
+
+// processControlDeltas passes encoder movements on, the mapping decides what they send.
+func processControlDeltas(frame serialprotocol.Frame, source string, eventChan chan<- controlmapping.ControlEvent) error {
+	deltas, err := serialprotocol.ParseControlDeltas(frame.Payload)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deltas {
+		if d.Delta == 0 {
+			continue
 		}
+		sendEvent(eventChan, controlmapping.ControlEvent{
+			ModuleID:  frame.ModuleID,
+			ControlID: d.Control,
+			Delta:     int(d.Delta),
+			Raw:       int(d.Delta),
+			Source:    source,
+		})
 	}
 
 	return nil
 }
 
+func sendEvent(eventChan chan<- controlmapping.ControlEvent, ev controlmapping.ControlEvent) {
+	controlmapping.PublishInput(ev)
+	// Send to the mapping engine (non-blocking)
+	select {
+	case eventChan <- ev:
+	default:
+		log.Println("Warning: Event channel full, dropping control event")
+	}
+}
+
+// watchSelectedUSBDevice polls usb_ports.json and closes the port once a different device is selected.
+func watchSelectedUSBDevice(current string, interval time.Duration, port serial.Port, changed chan<- struct{}, stopChan <-chan struct{}, done <-chan struct{}) {
+	if interval <= 0 {
+		interval = DefaultSerialConfig.SelectionPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-stopChan:
+			port.Close()
+			return
+		case <-ticker.C:
+			selected, err := getSelectedUSBDevice(FilePath)
+			if err != nil {
+				// The file may be rewritten by the frontend right now, try again on the next tick
+				continue
+			}
+			if selected != current {
+				log.Printf("USB device selection changed from %s to %s", current, selected)
+				close(changed)
+				port.Close()
+				return
+			}
+		}
+	}
+}
+
 func getSelectedUSBDevice(usbPortsListFile string) (string, error) {
 	// Read the content of the JSON file.
 	fileContent, err := os.ReadFile(usbPortsListFile)
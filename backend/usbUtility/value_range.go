@@ -0,0 +1,47 @@
+package usbUtility
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueRange is the inclusive range of raw values a transport delivers, e.g. 0-4095.
+type ValueRange struct {
+	Min int
+	Max int
+}
+
+// DefaultValueRange matches the 12-bit ADC of the ESP32.
+var DefaultValueRange = ValueRange{Min: 0, Max: 4095}
+
+// ParseValueRange parses ranges like "0-4095" from the [ranges] section.
+func ParseValueRange(value string) (ValueRange, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "-", 2)
+	if len(parts) != 2 {
+		return ValueRange{}, fmt.Errorf("invalid range '%s', expected min-max", value)
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return ValueRange{}, fmt.Errorf("invalid range minimum '%s': %w", parts[0], err)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return ValueRange{}, fmt.Errorf("invalid range maximum '%s': %w", parts[1], err)
+	}
+	if max <= min {
+		return ValueRange{}, fmt.Errorf("invalid range '%s', maximum must be larger than minimum", value)
+	}
+	return ValueRange{Min: min, Max: max}, nil
+}
+
+// Normalize maps a raw value into 0-1, clamping values outside the range.
+func (r ValueRange) Normalize(raw int) float64 {
+	if raw <= r.Min {
+		return 0
+	}
+	if raw >= r.Max {
+		return 1
+	}
+	return float64(raw-r.Min) / float64(r.Max-r.Min)
+}
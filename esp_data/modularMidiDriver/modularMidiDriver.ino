@@ -1,19 +1,136 @@
 const int analogPins[5] = { 34, 35, 32, 33, 36 };  // Adjust pins as needed
-const int hysteresisVal = 32;
-int lastRaw = 0;
+const int hysteresisVal = 3;  // ADC noise only, smoothing is done by the driver filters
+const uint8_t CONTROL_COUNT = sizeof(analogPins) / sizeof(analogPins[0]);
+int lastRaw[CONTROL_COUNT];  // Last value sent per fader
+
+// Frame layout: | 0xA5 | module ID | message type | payload length | payload ... | CRC8 |
+const uint8_t START_BYTE = 0xA5;
+// The main module of a USB chain is 0. Modules on Wi-Fi share the driver, so give every
+// one of them its own ID, the driver ignores a module reusing an ID that is in use.
+const uint8_t MODULE_ID = 0;
+const uint8_t MSG_CONTROL_CHANGE = 0x01;
+const uint8_t MSG_CONTROL_VALUE = 0x02;  // Raw 12-bit readings, scaled by the driver
+const uint8_t MSG_MODULE_JOIN = 0x03;
+const uint8_t MSG_HEARTBEAT = 0x05;  // Keeps the module in the driver's topology
+const uint8_t MSG_DESCRIPTOR = 0x06;
+const uint8_t MSG_DESCRIPTOR_REQUEST = 0x07;
+const uint8_t MSG_FEEDBACK = 0x08;  // (control, value high, value low) with 14-bit values from the DAW
+
+// Descriptor: module type, firmware version and (control ID, kind, resolution bits) per control
+const char MODULE_TYPE[] = "main";
+const uint8_t FIRMWARE_VERSION[3] = { 1, 0, 0 };
+const uint8_t KIND_FADER = 0x01;
+const uint8_t ADC_BITS = 12;
+const unsigned long heartbeatInterval = 1000;
+unsigned long lastHeartbeat = 0;
+
+uint8_t crc8(const uint8_t *data, size_t len) {
+  uint8_t crc = 0;
+  for (size_t i = 0; i < len; i++) {
+    crc ^= data[i];
+    for (int b = 0; b < 8; b++) {
+      crc = (crc & 0x80) ? (crc << 1) ^ 0x07 : crc << 1;
+    }
+  }
+  return crc;
+}
+
+void sendFrame(uint8_t type, const uint8_t *payload, uint8_t len) {
+  uint8_t header[3] = { MODULE_ID, type, len };
+  uint8_t crc = crc8(header, 3);
+  // Continue the checksum over the payload
+  for (uint8_t i = 0; i < len; i++) {
+    crc ^= payload[i];
+    for (int b = 0; b < 8; b++) {
+      crc = (crc & 0x80) ? (crc << 1) ^ 0x07 : crc << 1;
+    }
+  }
+  Serial.write(START_BYTE);
+  Serial.write(header, 3);
+  Serial.write(payload, len);
+  Serial.write(crc);
+}
+
+void sendDescriptor() {
+  const uint8_t typeLen = sizeof(MODULE_TYPE) - 1;
+  const uint8_t controlCount = CONTROL_COUNT;
+  uint8_t payload[1 + typeLen + 4 + controlCount * 3];
+  uint8_t n = 0;
+  payload[n++] = typeLen;
+  memcpy(&payload[n], MODULE_TYPE, typeLen);
+  n += typeLen;
+  payload[n++] = FIRMWARE_VERSION[0];
+  payload[n++] = FIRMWARE_VERSION[1];
+  payload[n++] = FIRMWARE_VERSION[2];
+  payload[n++] = controlCount;
+  for (uint8_t c = 0; c < controlCount; c++) {
+    payload[n++] = c + 1;  // Control IDs start at 1
+    payload[n++] = KIND_FADER;
+    payload[n++] = ADC_BITS;
+  }
+  sendFrame(MSG_DESCRIPTOR, payload, n);
+}
+
+// Frames from the driver, read one byte at a time: start byte, 3 header bytes, payload, CRC8
+uint8_t rxBuf[4 + 255 + 1];
+uint16_t rxLen = 0;
+
+// Last value the DAW reported per control, for LEDs once the hardware has them
+uint16_t feedbackValues[CONTROL_COUNT];
+
+void handleFrame(uint8_t type, const uint8_t *payload, uint8_t len) {
+  if (type == MSG_DESCRIPTOR_REQUEST) {
+    sendDescriptor();
+  } else if (type == MSG_FEEDBACK) {
+    for (uint8_t i = 0; i + 2 < len; i += 3) {
+      uint8_t control = payload[i];
+      if (control >= 1 && control <= CONTROL_COUNT) {
+        feedbackValues[control - 1] = (payload[i + 1] << 8) | payload[i + 2];
+      }
+    }
+  }
+}
+
+void readFrames() {
+  while (Serial.available() > 0) {
+    uint8_t b = Serial.read();
+    if (rxLen == 0 && b != START_BYTE) {
+      continue;
+    }
+    rxBuf[rxLen++] = b;
+    if (rxLen < 4 || rxLen < 4 + rxBuf[3] + 1) {
+      continue;
+    }
+    uint8_t len = rxBuf[3];
+    if (crc8(&rxBuf[1], 3 + len) == rxBuf[4 + len] && rxBuf[1] == MODULE_ID) {
+      handleFrame(rxBuf[2], &rxBuf[4], len);
+    }
+    rxLen = 0;
+  }
+}
+
 void setup() {
   Serial.begin(115200);  // Initialize serial communication
+  sendFrame(MSG_MODULE_JOIN, nullptr, 0);
+  sendDescriptor();
 }
 
 void loop() {
-  int i = 0;
-  int raw = analogRead(analogPins[i]);  // Read analog value (0-4095)
-  if (raw > lastRaw && (raw - lastRaw) > hysteresisVal || lastRaw > raw && (lastRaw - raw) > hysteresisVal) {
-    uint8_t mapped = map(raw, 0, 4095, 0, 127);  // Map to 7-bit range
-    uint8_t currI = i;
-    Serial.write(i + 1);
-    Serial.write(mapped);  // Send as uint8_t
-    Serial.println();
+  readFrames();
+
+  // Every fader advertised in the descriptor, control ID i + 1
+  for (uint8_t i = 0; i < CONTROL_COUNT; i++) {
+    int raw = analogRead(analogPins[i]);  // Read analog value (0-4095)
+    if (raw > lastRaw[i] && (raw - lastRaw[i]) > hysteresisVal || lastRaw[i] > raw && (lastRaw[i] - raw) > hysteresisVal) {
+      uint8_t payload[3] = { (uint8_t)(i + 1), (uint8_t)(raw >> 8), (uint8_t)(raw & 0xFF) };
+      sendFrame(MSG_CONTROL_VALUE, payload, 3);
+      // Compare against the last sent value so slow movements add up
+      lastRaw[i] = raw;
+    }
+  }
+
+  if (millis() - lastHeartbeat >= heartbeatInterval) {
+    sendFrame(MSG_HEARTBEAT, nullptr, 0);
+    lastHeartbeat = millis();
   }
-  lastRaw = analogRead(analogPins[i]);
 }
@@ -41,6 +41,30 @@ type MIDIDeviceData struct {
 	SelectedMIDIDevice   string      `json:"selected_midi_device"`
 }
 
+type ControlDescriptor struct {
+	ID         uint8  `json:"id"`
+	Kind       string `json:"kind"`
+	Resolution uint8  `json:"resolution"`
+}
+
+type ModuleDescriptor struct {
+	ModuleType string              `json:"module_type"`
+	Firmware   string              `json:"firmware"`
+	Controls   []ControlDescriptor `json:"controls"`
+}
+
+type ModuleInfo struct {
+	ID         uint8             `json:"id"`
+	Source     string            `json:"source"`
+	Parent     *uint8            `json:"parent"`
+	HopPath    []uint8           `json:"hop_path"`
+	Descriptor *ModuleDescriptor `json:"descriptor"`
+}
+
+type ModuleTopology struct {
+	Modules []ModuleInfo `json:"modules"`
+}
+
 type DeviceManager struct {
 	rootPath           string
 	confPath           string
@@ -49,6 +73,7 @@ type DeviceManager struct {
 	// UI elements
 	usbList     *widget.List
 	midiList    *widget.List
+	moduleList  *widget.List
 	statusLabel *widget.Label
 	refreshBtn  *widget.Button
 	testMidiBtn *widget.Button
@@ -56,6 +81,7 @@ type DeviceManager struct {
 	// Data
 	usbData      *USBDeviceData
 	midiData     *MIDIDeviceData
+	modules      []ModuleInfo
 	usbFilePath  string
 	midiFilePath string
 }
@@ -174,6 +200,26 @@ func (dm *DeviceManager) getMIDIFileContent() error {
 	return nil
 }
 
+func (dm *DeviceManager) getModules() error {
+	resp, err := http.Get(strings.Join([]string{dm.backendApiLocation, "/moduleTopology"}, ""))
+	if err != nil {
+		return fmt.Errorf("failed to call API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API returned status code: %d", resp.StatusCode)
+	}
+
+	var topology ModuleTopology
+	if err := json.NewDecoder(resp.Body).Decode(&topology); err != nil {
+		return fmt.Errorf("failed to parse JSON: %v", err)
+	}
+
+	dm.modules = topology.Modules
+	return nil
+}
+
 func (dm *DeviceManager) selectUSBDevice(index int) error {
 	if dm.usbData == nil || index < 0 || index >= len(dm.usbData.AvailableUSBDevices) {
 		return fmt.Errorf("invalid USB device index")
@@ -250,9 +296,16 @@ func (dm *DeviceManager) refreshData(window fyne.Window) {
 			dm.updateStatus(fmt.Sprintf("Error loading MIDI devices: %v", err))
 		}
 
+		// Refresh attached modules
+		err = dm.getModules()
+		if err != nil {
+			dm.updateStatus(fmt.Sprintf("Error loading modules: %v", err))
+		}
+
 		// Update UI on main thread
 		dm.usbList.Refresh()
 		dm.midiList.Refresh()
+		dm.moduleList.Refresh()
 		dm.updateStatus("Devices refreshed successfully")
 	}()
 }
@@ -365,6 +418,80 @@ func (dm *DeviceManager) createMIDIList() *widget.List {
 	return list
 }
 
+func (dm *DeviceManager) createModuleList() *widget.List {
+	return widget.NewList(
+		func() int {
+			return len(dm.modules)
+		},
+		func() fyne.CanvasObject {
+			return container.NewVBox(
+				container.NewHBox(
+					widget.NewIcon(theme.StorageIcon()),
+					widget.NewLabel("Template"),
+					layout.NewSpacer(),
+					widget.NewLabel("Firmware"),
+				),
+				widget.NewLabel("Controls"),
+			)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= len(dm.modules) {
+				return
+			}
+
+			module := dm.modules[id]
+			rows := obj.(*fyne.Container)
+			header := rows.Objects[0].(*fyne.Container)
+
+			name := fmt.Sprintf("Module %d (%s)", module.ID, module.Source)
+			if module.Parent != nil {
+				name = fmt.Sprintf("%s via module %d", name, *module.Parent)
+			}
+			firmware := "Waiting for descriptor"
+			controls := ""
+			if d := module.Descriptor; d != nil {
+				name = fmt.Sprintf("%s - %s", name, d.ModuleType)
+				firmware = "Firmware " + d.Firmware
+				controls = describeControls(d.Controls)
+			}
+
+			header.Objects[1].(*widget.Label).SetText(name)
+			header.Objects[3].(*widget.Label).SetText(firmware)
+			rows.Objects[1].(*widget.Label).SetText(controls)
+		},
+	)
+}
+
+// describeControls summarises the controls of a module, e.g. "4 fader (12 bit), 2 button".
+func describeControls(controls []ControlDescriptor) string {
+	type group struct {
+		kind       string
+		resolution uint8
+	}
+	var order []group
+	counts := make(map[group]int)
+	for _, c := range controls {
+		g := group{c.Kind, c.Resolution}
+		if counts[g] == 0 {
+			order = append(order, g)
+		}
+		counts[g]++
+	}
+
+	parts := make([]string, 0, len(order))
+	for _, g := range order {
+		part := fmt.Sprintf("%d %s", counts[g], g.kind)
+		if g.resolution > 1 {
+			part = fmt.Sprintf("%s (%d bit)", part, g.resolution)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "No controls"
+	}
+	return strings.Join(parts, ", ")
+}
+
 func (dm *DeviceManager) createMainWindow() fyne.Window {
 	myApp := app.New()
 	myApp.SetIcon(theme.ComputerIcon())
@@ -395,6 +522,7 @@ func (dm *DeviceManager) createMainWindow() fyne.Window {
 	// Create device lists
 	dm.usbList = dm.createUSBList()
 	dm.midiList = dm.createMIDIList()
+	dm.moduleList = dm.createModuleList()
 
 	// Create layout
 	usbCard := widget.NewCard("USB Devices", "Select a USB device from the list below",
@@ -403,6 +531,9 @@ func (dm *DeviceManager) createMainWindow() fyne.Window {
 	midiCard := widget.NewCard("MIDI Devices", "Select a MIDI device from the list below",
 		container.NewBorder(nil, nil, nil, nil, dm.midiList))
 
+	moduleCard := widget.NewCard("Modules", "Modules attached to the driver and their controls",
+		container.NewGridWrap(fyne.NewSize(760, 300), dm.moduleList))
+
 	buttonContainer := container.NewHBox(
 		dm.refreshBtn,
 		dm.testMidiBtn,
@@ -410,6 +541,7 @@ func (dm *DeviceManager) createMainWindow() fyne.Window {
 
 	mainContent := container.NewVBox(
 		container.NewHBox(usbCard, midiCard),
+		moduleCard,
 		container.NewBorder(nil, nil, nil, nil, buttonContainer),
 		dm.statusLabel,
 	)
@@ -6,11 +6,14 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	midiports "modularMidiGoApp/backend/midiUtility/midiPorts"
+
 	"gopkg.in/ini.v1"
 )
 
@@ -27,11 +30,21 @@ type USBDeviceData struct {
 type MIDIDevice struct {
 	Name     string `json:"name"`
 	PortPath string `json:"port_path"`
+	Driver   string `json:"driver,omitempty"`
 }
 
 type MIDIDeviceData struct {
-	AvailableMIDIDevices []MIDIDevice `json:"available_midi_ports"`
-	SelectedMIDIDevice   MIDIDevice   `json:"selected_midi_port"`
+	AvailableMIDIDevices   []MIDIDevice `json:"available_midi_ports"`
+	SelectedMIDIDevice     MIDIDevice   `json:"selected_midi_port"`
+	SelectedMIDIDevices    []MIDIDevice `json:"selected_midi_ports"`
+	AvailableMIDIInDevices []MIDIDevice `json:"available_midi_in_ports"`
+	SelectedMIDIInDevice   MIDIDevice   `json:"selected_midi_in_port"`
+}
+
+type PresetInfo struct {
+	Name     string `json:"name"`
+	Mappings int    `json:"mappings"`
+	Active   bool   `json:"active"`
 }
 
 var (
@@ -136,12 +149,42 @@ func main() {
 			os.Exit(1)
 		}
 		selectMIDIDevice(os.Args[2])
+	case "add-MIDI", "remove-MIDI":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Please provide a MIDI device index")
+			fmt.Printf("Usage: usb-manager %s <index>\n", command)
+			os.Exit(1)
+		}
+		updateMIDIOutputs(os.Args[2], command == "add-MIDI")
+	case "select-MIDI-in":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Please provide a MIDI input index to select")
+			fmt.Println("Usage: usb-manager select-MIDI-in <index>")
+			os.Exit(1)
+		}
+		selectMIDIInDevice(os.Args[2])
 	case "test-midi":
 		testMidiOutput()
 		fmt.Println("MIDI output test triggered.")
 	case "list-midi":
 		listMIDI()
 		fmt.Println("MIDI ports listed.")
+	case "list-presets":
+		listPresets()
+	case "select-preset":
+		if len(os.Args) < 3 {
+			fmt.Println("Error: Please provide the name of the preset to activate")
+			fmt.Println("Usage: usb-manager select-preset <name>")
+			os.Exit(1)
+		}
+		selectPreset(os.Args[2])
+	case "duplicate-preset":
+		if len(os.Args) < 4 {
+			fmt.Println("Error: Please provide the preset to copy and the name of the copy")
+			fmt.Println("Usage: usb-manager duplicate-preset <from> <to>")
+			os.Exit(1)
+		}
+		duplicatePreset(os.Args[2], os.Args[3])
 	case "help":
 		printUsage()
 	default:
@@ -156,11 +199,18 @@ func printUsage() { // Print usage instructions for the CLI tool
 	fmt.Println("Usage:")
 	fmt.Println("  usb-manager list           - List all available USB devices")
 	fmt.Println("  usb-manager select <index> - Select a USB device by index")
+	fmt.Println("  usb-manager add-MIDI <index>            - Also send to a MIDI output")
+	fmt.Println("  usb-manager remove-MIDI <index>         - Stop sending to a MIDI output")
+	fmt.Println("  usb-manager select-MIDI-in <index>      - Select the MIDI input used for feedback")
+	fmt.Println("  usb-manager list-presets   - List all mapping presets")
+	fmt.Println("  usb-manager select-preset <name>        - Activate a mapping preset")
+	fmt.Println("  usb-manager duplicate-preset <from> <to> - Copy a mapping preset")
 	fmt.Println("  usb-manager help           - Show this help message")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  usb-manager list")
 	fmt.Println("  usb-manager select 3")
+	fmt.Println("  usb-manager duplicate-preset default lighting")
 }
 
 func getRootPath() string {
@@ -332,6 +382,26 @@ func listMIDI() {
 	} else {
 		fmt.Println("No MIDI device currently selected.")
 	}
+
+	for _, device := range midiData.SelectedMIDIDevices {
+		fmt.Printf("Also sending to: %s (%s)\n", device.Name, device.PortPath)
+	}
+
+	fmt.Println()
+	fmt.Println("Available MIDI Inputs (feedback):")
+	fmt.Println("=================================")
+
+	for i, device := range midiData.AvailableMIDIInDevices {
+		fmt.Printf("[%d] %s\n", i+1, device.Name)
+		fmt.Printf("    Device Path: %s\n", device.PortPath)
+		fmt.Println()
+	}
+
+	if midiData.SelectedMIDIInDevice.PortPath != "" {
+		fmt.Printf("Currently selected MIDI input path: %s\n", midiData.SelectedMIDIInDevice.PortPath)
+	} else {
+		fmt.Println("No MIDI input selected, feedback is disabled.")
+	}
 }
 
 func selectUSBDevice(indexStr string) {
@@ -427,3 +497,192 @@ func selectMIDIDevice(indexStr string) {
 	fmt.Printf("  Device Path: %s\n", selectedDevice.PortPath)
 	fmt.Printf("  Saved to: %s\n", filePath)
 }
+
+// updateMIDIOutputs adds a port to or removes it from the ports used at the same time.
+func updateMIDIOutputs(indexStr string, add bool) {
+	midiData, filePath, err := getMIDIFileContent()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		fmt.Printf("Error: Invalid index '%s'. Please provide a valid number.\n", indexStr)
+		os.Exit(1)
+	}
+	if index < 1 || index > len(midiData.AvailableMIDIDevices) {
+		fmt.Printf("Error: Index %d is out of range. Available devices: 1-%d\n", index, len(midiData.AvailableMIDIDevices))
+		os.Exit(1)
+	}
+	device := midiData.AvailableMIDIDevices[index-1]
+
+	// Find the entry the way the driver does, the numbers may have changed since it was added
+	selected := midiData.SelectedMIDIDevices
+	if i, found := findSelectedOutput(selected, device); found {
+		selected = append(selected[:i:i], selected[i+1:]...)
+	} else if !add {
+		fmt.Printf("Error: %s (%s) is not a selected output\n", device.Name, device.PortPath)
+		os.Exit(1)
+	}
+	if add {
+		selected = append(selected, device)
+	}
+	midiData.SelectedMIDIDevices = selected
+
+	updatedJSON, err := json.MarshalIndent(midiData, "", "  ")
+	if err != nil {
+		fmt.Printf("Error: Failed to marshal JSON: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filePath, updatedJSON, 0644); err != nil {
+		fmt.Printf("Error: Failed to write to file %s: %v\n", filePath, err)
+		os.Exit(1)
+	}
+
+	if add {
+		fmt.Printf("Added MIDI output %s (%s)\n", device.Name, device.PortPath)
+	} else {
+		fmt.Printf("Removed MIDI output %s (%s)\n", device.Name, device.PortPath)
+	}
+	if add {
+		fmt.Println("Mappings can send to it by listing its name in \"ports\".")
+	}
+	fmt.Println("The running driver picks up the change within a few seconds.")
+}
+
+// findSelectedOutput returns the index of the selected output that is device, by
+// exact or name match like the driver. Loose name matches don't count.
+func findSelectedOutput(selected []MIDIDevice, device MIDIDevice) (int, bool) {
+	ids := make([]midiports.PortID, len(selected))
+	for i, d := range selected {
+		ids[i] = midiports.PortID(d)
+	}
+	i, kind, err := midiports.Match(midiports.PortID(device), ids)
+	return i, err == nil && kind != midiports.MatchFuzzy
+}
+
+func selectMIDIInDevice(indexStr string) {
+	midiData, filePath, err := getMIDIFileContent()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Parse the index
+	index, err := strconv.Atoi(indexStr)
+	if err != nil {
+		fmt.Printf("Error: Invalid index '%s'. Please provide a valid number.\n", indexStr)
+		os.Exit(1)
+	}
+
+	// Validate the index
+	if index < 1 || index > len(midiData.AvailableMIDIInDevices) {
+		fmt.Printf("Error: Index %d is out of range. Available inputs: 1-%d\n", index, len(midiData.AvailableMIDIInDevices))
+		os.Exit(1)
+	}
+
+	selectedDevice := midiData.AvailableMIDIInDevices[index-1]
+	midiData.SelectedMIDIInDevice = selectedDevice
+
+	updatedJSON, err := json.MarshalIndent(midiData, "", "  ")
+	if err != nil {
+		fmt.Printf("Error: Failed to marshal JSON: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = os.WriteFile(filePath, updatedJSON, 0644)
+	if err != nil {
+		fmt.Printf("Error: Failed to write to file %s: %v\n", filePath, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Successfully selected MIDI input:\n")
+	fmt.Printf("  Name: %s\n", selectedDevice.Name)
+	fmt.Printf("  Device Path: %s\n", selectedDevice.PortPath)
+	fmt.Printf("  Saved to: %s\n", filePath)
+	// The input is opened once at start, unlike the outputs it isn't watched
+	fmt.Println("Restart the driver to start listening on the new input.")
+}
+
+// getPresets retrieves the list of mapping presets from the API
+func getPresets() ([]PresetInfo, error) {
+	resp, err := http.Get(strings.Join([]string{backendApiLocation, "/presets"}, ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	return decodePresets(resp)
+}
+
+// postPresetAction calls one of the preset routes that change presets
+func postPresetAction(path string, query url.Values) ([]PresetInfo, error) {
+	resp, err := http.Post(strings.Join([]string{backendApiLocation, path, "?", query.Encode()}, ""), "application/json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	return decodePresets(resp)
+}
+
+func decodePresets(resp *http.Response) ([]PresetInfo, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var presets []PresetInfo
+	if err := json.Unmarshal(body, &presets); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	return presets, nil
+}
+
+func printPresets(presets []PresetInfo) {
+	fmt.Println("Mapping Presets:")
+	fmt.Println("================")
+
+	for i, preset := range presets {
+		marker := ""
+		if preset.Active {
+			marker = " (active)"
+		}
+		fmt.Printf("[%d] %s%s\n", i+1, preset.Name, marker)
+		fmt.Printf("    Mappings: %d\n", preset.Mappings)
+		fmt.Println()
+	}
+}
+
+func listPresets() {
+	presets, err := getPresets()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	printPresets(presets)
+}
+
+func selectPreset(name string) {
+	presets, err := postPresetAction("/activatePreset", url.Values{"name": {name}})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Successfully activated preset: %s\n\n", name)
+	printPresets(presets)
+}
+
+func duplicatePreset(from string, to string) {
+	presets, err := postPresetAction("/duplicatePreset", url.Values{"from": {from}, "to": {to}})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Successfully copied preset %s to %s\n\n", from, to)
+	printPresets(presets)
+}
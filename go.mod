@@ -8,6 +8,7 @@ require (
 	fyne.io/fyne/v2 v2.6.1
 	gitlab.com/gomidi/midi/v2 v2.3.14
 	go.bug.st/serial v1.6.4
+	golang.org/x/net v0.35.0
 	gopkg.in/ini.v1 v1.67.0
 )
 
@@ -41,7 +42,6 @@ require (
 	github.com/stretchr/testify v1.10.0 // indirect
 	github.com/yuin/goldmark v1.7.8 // indirect
 	golang.org/x/image v0.24.0 // indirect
-	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect